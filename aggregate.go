@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"slices"
+)
+
+// summarizeCIDRs 将地址列表合并为恰好覆盖这些地址的最少CIDR块，IPv4 排在 IPv6 之前。
+// 无法解析为IP的目标(如域名)会被忽略
+func summarizeCIDRs(ips []string) []netip.Prefix {
+	var addrs []netip.Addr
+	for _, s := range ips {
+		if addr, err := netip.ParseAddr(s); err == nil {
+			addrs = append(addrs, addr.Unmap().WithZone(""))
+		}
+	}
+	slices.SortFunc(addrs, netip.Addr.Compare)
+	addrs = slices.Compact(addrs)
+
+	var prefixes []netip.Prefix
+	for i := 0; i < len(addrs); {
+		// 找出从 addrs[i] 开始的连续地址段
+		start, end := addrs[i], addrs[i]
+		for i++; i < len(addrs) && addrs[i] == end.Next() && addrs[i].Is4() == start.Is4(); i++ {
+			end = addrs[i]
+		}
+		prefixes = appendRange(prefixes, start, end)
+	}
+	return prefixes
+}
+
+// appendRange 将闭区间 [start, end] 拆分为最少的CIDR块
+func appendRange(prefixes []netip.Prefix, start, end netip.Addr) []netip.Prefix {
+	for {
+		// 从最短的前缀开始，取以 start 为网络地址且不超出 end 的最大块
+		bits := 0
+		for ; bits < start.BitLen(); bits++ {
+			p := netip.PrefixFrom(start, bits)
+			if p.Masked().Addr() == start && lastAddr(p).Compare(end) <= 0 {
+				break
+			}
+		}
+		p := netip.PrefixFrom(start, bits)
+		prefixes = append(prefixes, p)
+
+		last := lastAddr(p)
+		if last.Compare(end) >= 0 || !last.Next().IsValid() {
+			return prefixes
+		}
+		start = last.Next()
+	}
+}
+
+// lastAddr 返回前缀中的最后一个地址
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// writeCIDRs 将地址合并为CIDR块后逐行写入文件
+func writeCIDRs(filename string, ips []string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("无法创建文件: %v", err)
+	}
+	defer file.Close()
+
+	prefixes := summarizeCIDRs(ips)
+	w := bufio.NewWriter(file)
+	for _, p := range prefixes {
+		fmt.Fprintln(w, p)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("无法写入文件: %v", err)
+	}
+
+	slog.Info("成功将地址合并为CIDR写入文件", "file", filename, "addrs", len(ips), "cidrs", len(prefixes))
+	return nil
+}
+
+// writeIPList 将地址逐行写入文件
+func writeIPList(filename string, ips []string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("无法创建文件: %v", err)
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	for _, ip := range ips {
+		fmt.Fprintln(w, ip)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("无法写入文件: %v", err)
+	}
+
+	slog.Info("成功将地址列表写入文件", "file", filename, "addrs", len(ips))
+	return nil
+}
+
+// writeTargetLists 按 -alive-file/-dead-file 输出有响应和无响应目标的地址列表，
+// 按 -alive-cidrs/-dead-cidrs 输出它们的CIDR汇总，按 -limited-file 输出疑似被限速的目标，返回写入的文件。
+// 有响应的地址按延迟排序，无响应的按输入顺序，被限速的目标不计为无响应
+func writeTargetLists(targets []target, results []result, limited []string) ([]string, error) {
+	alive := make(map[string]bool, len(results)+len(limited))
+	var aliveIPs []string
+	for _, res := range results {
+		alive[res.ip] = true
+		aliveIPs = append(aliveIPs, res.ip)
+	}
+	for _, ip := range limited {
+		alive[ip] = true
+	}
+
+	var deadIPs []string
+	for _, t := range targets {
+		if !alive[t.ip] {
+			deadIPs = append(deadIPs, t.ip)
+		}
+	}
+
+	outputs := []struct {
+		filename string
+		write    func(string, []string) error
+		ips      []string
+	}{
+		{*aliveFile, writeIPList, aliveIPs},
+		{*deadFile, writeIPList, deadIPs},
+		{*aliveCIDRs, writeCIDRs, aliveIPs},
+		{*deadCIDRs, writeCIDRs, deadIPs},
+		{*limitedFile, writeIPList, limited},
+	}
+	var files []string
+	for _, out := range outputs {
+		if out.filename == "" {
+			continue
+		}
+		if err := out.write(out.filename, out.ips); err != nil {
+			return nil, err
+		}
+		files = append(files, out.filename)
+	}
+	return files, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestSummarizeCIDRs(t *testing.T) {
+	rangeIPs := func(prefix string, from, to int) []string {
+		var ips []string
+		for i := from; i <= to; i++ {
+			ips = append(ips, fmt.Sprintf("%s.%d", prefix, i))
+		}
+		return ips
+	}
+	tests := []struct {
+		name string
+		ips  []string
+		want []string
+	}{
+		{"adjacent", rangeIPs("10.0.0", 0, 3), []string{"10.0.0.0/30"}},
+		{"merged halves", append(rangeIPs("10.0.1", 128, 255), rangeIPs("10.0.1", 0, 127)...), []string{"10.0.1.0/24"}},
+		{"unaligned", rangeIPs("10.0.0", 1, 6), []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/31", "10.0.0.6/32"}},
+		{"gap", []string{"10.0.0.1", "10.0.0.3"}, []string{"10.0.0.1/32", "10.0.0.3/32"}},
+		{"duplicates", []string{"10.0.0.2", "10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.0", "::ffff:10.0.0.1"}, []string{"10.0.0.0/30"}},
+		{"mixed families", []string{"2001:db8::1", "10.0.0.1", "2001:db8::", "::ffff:10.0.0.0", "example.com"}, []string{"10.0.0.0/31", "2001:db8::/127"}},
+		{"end of space", []string{"255.255.255.255", "255.255.255.254"}, []string{"255.255.255.254/31"}},
+		{"v4 end next to v6", []string{"255.255.255.255", "::"}, []string{"255.255.255.255/32", "::/128"}},
+		{"zone", []string{"fe80::1%eth0", "fe80::"}, []string{"fe80::/127"}},
+		{"empty", nil, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, p := range summarizeCIDRs(tt.ips) {
+			got = append(got, p.String())
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: summarizeCIDRs = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hostCapture 汇总抓包文件中发往单个目标的回显请求和匹配到的应答
+type hostCapture struct {
+	ip       string
+	sent     int
+	received int
+	rtts     []time.Duration
+}
+
+func (h *hostCapture) loss() float64 {
+	return float64(h.sent-h.received) / float64(h.sent) * 100
+}
+
+func (h *hostCapture) mean() time.Duration {
+	var sum time.Duration
+	for _, d := range h.rtts {
+		sum += d
+	}
+	return sum / time.Duration(len(h.rtts))
+}
+
+// analyzeCapture 按实时探测的规则重新匹配抓包中的回显请求和应答: 请求发出后 -timeout 内
+// 收到的、经 matchEcho 判断与之标识符、序号和目标都一致的回显应答才算成功，
+// 对应的差错消息和超时均计为失败，超时后才到达的应答被忽略
+func analyzeCapture(packets []capturedPacket) []*hostCapture {
+	type request struct {
+		ts   time.Time
+		host *hostCapture
+	}
+	outstanding := make(map[string]request)
+	hosts := make(map[string]*hostCapture)
+	var order []*hostCapture
+
+	// 键由请求源、请求目标、标识符和序号组成
+	key := func(src, dst net.IP, id, seq int) string {
+		return fmt.Sprintf("%s|%s|%d|%d", src, dst, id, seq)
+	}
+
+	for _, p := range packets {
+		if len(p.msg) >= 8 && (p.proto == 1 && p.msg[0] == 8 || p.proto == 58 && p.msg[0] == 128) {
+			ip := p.dst.String()
+			host, ok := hosts[ip]
+			if !ok {
+				host = &hostCapture{ip: ip}
+				hosts[ip] = host
+				order = append(order, host)
+			}
+			host.sent++
+			id, seq := int(p.msg[4])<<8|int(p.msg[5]), int(p.msg[6])<<8|int(p.msg[7])
+			outstanding[key(p.src, p.dst, id, seq)] = request{p.ts, host}
+			continue
+		}
+
+		m, ok := matchEcho(p.proto, p.msg)
+		if !ok || m.extended {
+			continue
+		}
+		target := m.target
+		if target == nil {
+			target = p.src
+		}
+		k := key(p.dst, target, m.id, m.seq)
+		req, ok := outstanding[k]
+		if !ok {
+			continue
+		}
+		delete(outstanding, k)
+		if m.err == nil && p.ts.Sub(req.ts) <= *timeout {
+			req.host.received++
+			req.host.rtts = append(req.host.rtts, p.ts.Sub(req.ts))
+		}
+	}
+
+	// 有应答的目标按平均延迟升序排在前面，其余按首次出现的顺序
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if (a.received > 0) != (b.received > 0) {
+			return a.received > 0
+		}
+		return a.received > 0 && a.mean() < b.mean()
+	})
+	return order
+}
+
+// runAnalyze 实现 analyze 子命令: 从pcap文件重新计算每个目标的往返延迟和丢包率
+func runAnalyze(args []string) {
+	if f := flag.Lookup("outfile"); f != nil {
+		f.DefValue = "analyze.csv"
+		f.Value.Set(f.DefValue)
+	}
+
+	// 抓包文件可以写在参数之前，如 analyze scan.pcap -timeout 2s
+	var filename string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		filename, args = args[0], args[1:]
+	}
+	flag.CommandLine.Parse(args)
+	if filename == "" {
+		filename = flag.Arg(0)
+	}
+
+	if err := setupLogging(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	if _, ok := latencyUnits[*unit]; !ok {
+		slog.Error("未知的延迟单位", "unit", *unit)
+		return
+	}
+	if err := validateHeaders(); err != nil {
+		slog.Error(err.Error())
+		return
+	}
+	if filename == "" {
+		slog.Error("请指定要分析的抓包文件")
+		return
+	}
+
+	packets, err := readPcap(filename)
+	if err != nil {
+		slog.Error(err.Error())
+		return
+	}
+	hosts := analyzeCapture(packets)
+	if len(hosts) == 0 {
+		slog.Warn("抓包文件中没有ICMP回显请求", "packets", len(packets))
+		return
+	}
+
+	if err := writeAnalysis(*outFile, hosts); err != nil {
+		slog.Error(err.Error())
+		return
+	}
+
+	var sent, received int
+	for _, h := range hosts {
+		sent += h.sent
+		received += h.received
+	}
+	slog.Info("成功将抓包分析结果写入文件", "file", *outFile, "packets", len(packets), "hosts", len(hosts), "sent", sent, "received", received)
+}
+
+func writeAnalysis(filename string, hosts []*hostCapture) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("无法创建文件: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write(headerNames([]string{"IP地址", "发送", "接收", "丢包率", unitColumn("平均延迟"), unitColumn("最小延迟"), unitColumn("最大延迟")}))
+	for _, h := range hosts {
+		row := []string{h.ip, strconv.Itoa(h.sent), strconv.Itoa(h.received), fmt.Sprintf("%.1f%%", h.loss()), "", "", ""}
+		if len(h.rtts) > 0 {
+			lo, hi := h.rtts[0], h.rtts[0]
+			for _, d := range h.rtts[1:] {
+				lo = min(lo, d)
+				hi = max(hi, d)
+			}
+			row[4], row[5], row[6] = formatValue(h.mean()), formatValue(lo), formatValue(hi)
+		}
+		writer.Write(row)
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("写入CSV文件时出现错误: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// assertVars 为 -assert 表达式可用的变量。alive 为有响应目标的百分比，limited 为疑似被限速的目标数，
+// 延迟相关的变量单位为毫秒，均只统计有响应的目标
+var assertVars = []string{"total", "responded", "dead", "limited", "alive", "min", "avg", "max", "stddev", "p50", "p90", "p95", "p99"}
+
+// parseAssertion 编译 -assert 表达式，未设置时返回 nil
+func parseAssertion(src string) (*expression, error) {
+	if src == "" {
+		return nil, nil
+	}
+	e, err := parseExpression(src, assertVars)
+	if err != nil {
+		return nil, fmt.Errorf("无法解析 -assert 条件: %v", err)
+	}
+	return e, nil
+}
+
+// scanStats 汇总整次扫描的结果，probed 为探测的目标总数，
+// limited 为其中疑似被限速的目标数，这些目标不计为无响应
+func scanStats(results []result, probed int64, limited int) map[string]float64 {
+	stats := map[string]float64{
+		"total":     float64(probed),
+		"responded": float64(len(results)),
+		"dead":      float64(probed - int64(len(results)) - int64(limited)),
+		"limited":   float64(limited),
+	}
+	if probed > 0 {
+		stats["alive"] = float64(len(results)) / float64(probed) * 100
+	}
+	if len(results) == 0 {
+		return stats
+	}
+
+	ms := make([]float64, len(results))
+	var sum float64
+	for i, res := range results {
+		ms[i] = float64(res.duration) / 1e6
+		sum += ms[i]
+	}
+	// 设置了 -score 或 -weights 时结果按得分而不是延迟排列
+	sort.Float64s(ms)
+	avg := sum / float64(len(ms))
+	var variance float64
+	for _, v := range ms {
+		variance += (v - avg) * (v - avg)
+	}
+
+	stats["min"] = ms[0]
+	stats["max"] = ms[len(ms)-1]
+	stats["avg"] = avg
+	stats["stddev"] = math.Sqrt(variance / float64(len(ms)))
+	for _, p := range []int{50, 90, 95, 99} {
+		stats["p"+strconv.Itoa(p)] = percentile(ms, p)
+	}
+	return stats
+}
+
+// percentile 按最近秩法取升序数据的第 p 百分位数
+func percentile(sorted []float64, p int) float64 {
+	rank := int(math.Ceil(float64(p) / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+// checkAssertion 对扫描结果求值 -assert 条件并记录结果
+func checkAssertion(e *expression, results []result, probed int64, limited int) bool {
+	stats := scanStats(results, probed, limited)
+	attrs := make([]any, 0, 2*len(assertVars)+2)
+	attrs = append(attrs, "assert", e.src)
+	for _, v := range assertVars {
+		attrs = append(attrs, v, math.Round(stats[v]*100)/100)
+	}
+
+	if !e.test(stats) {
+		slog.Error("断言失败", attrs...)
+		return false
+	}
+	slog.Info("断言通过", attrs...)
+	return true
+}
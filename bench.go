@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// benchStat 汇总单个IP在多轮扫描中的延迟和排名
+type benchStat struct {
+	ip        string
+	latencies []float64 // 每轮成功时的延迟，以 -unit 为单位
+	ranks     []int     // 每轮成功时的排名，从1开始
+}
+
+func (b *benchStat) mean() float64 {
+	var sum float64
+	for _, v := range b.latencies {
+		sum += v
+	}
+	return sum / float64(len(b.latencies))
+}
+
+func (b *benchStat) stddev() float64 {
+	m := b.mean()
+	var sum float64
+	for _, v := range b.latencies {
+		sum += (v - m) * (v - m)
+	}
+	return math.Sqrt(sum / float64(len(b.latencies)))
+}
+
+func (b *benchStat) meanRank() float64 {
+	var sum int
+	for _, r := range b.ranks {
+		sum += r
+	}
+	return float64(sum) / float64(len(b.ranks))
+}
+
+// rankChange 返回各轮排名中最好与最差之间的差值
+func (b *benchStat) rankChange() int {
+	lo, hi := b.ranks[0], b.ranks[0]
+	for _, r := range b.ranks[1:] {
+		lo = min(lo, r)
+		hi = max(hi, r)
+	}
+	return hi - lo
+}
+
+// runBench 实现 bench 子命令: 重复执行完整扫描并统计每个IP在各轮之间的稳定性
+func runBench(args []string) {
+	runs := flag.Int("runs", 3, "重复扫描的轮数")
+	if f := flag.Lookup("outfile"); f != nil {
+		f.DefValue = "bench.csv"
+		f.Value.Set(f.DefValue)
+	}
+	flag.CommandLine.Parse(args)
+
+	if err := setupLogging(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	startPprof()
+	if *runs < 1 {
+		slog.Error("轮数必须大于0")
+		return
+	}
+
+	startTime := time.Now()
+
+	s, err := newScanner()
+	if err != nil {
+		slog.Error(err.Error())
+		return
+	}
+
+	targets, _, err := loadTargets()
+	if err != nil {
+		slog.Error(err.Error())
+		return
+	}
+
+	stats := make(map[string]*benchStat)
+	for run := 1; run <= *runs; run++ {
+		slog.Info("开始扫描", "run", run, "runs", *runs)
+		for rank, res := range s.run(targets) {
+			st, ok := stats[res.ip]
+			if !ok {
+				st = &benchStat{ip: res.ip}
+				stats[res.ip] = st
+			}
+			st.latencies = append(st.latencies, latencyValue(res.duration))
+			st.ranks = append(st.ranks, rank+1)
+		}
+	}
+
+	if len(stats) == 0 {
+		slog.Warn("没有发现有效的IP")
+		return
+	}
+
+	list := make([]*benchStat, 0, len(stats))
+	for _, st := range stats {
+		list = append(list, st)
+	}
+	// 每轮都成功的IP优先，其次按平均延迟排序
+	sort.Slice(list, func(i, j int) bool {
+		if len(list[i].latencies) != len(list[j].latencies) {
+			return len(list[i].latencies) > len(list[j].latencies)
+		}
+		return list[i].mean() < list[j].mean()
+	})
+
+	if err := writeBench(*outFile, list, *runs); err != nil {
+		slog.Error(err.Error())
+		return
+	}
+
+	slog.Info("成功将稳定性统计写入文件", "file", *outFile, "runs", *runs, "elapsed", time.Since(startTime).Round(time.Second))
+}
+
+func writeBench(filename string, list []*benchStat, runs int) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("无法创建文件: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	// 延迟方差的单位为 -unit 的平方
+	writer.Write(headerNames([]string{"IP地址", "成功轮数", unitColumn("平均延迟"), unitColumn("延迟标准差"), "延迟方差", "平均排名", "排名变化"}))
+	for _, st := range list {
+		sd := st.stddev()
+		writer.Write([]string{
+			st.ip,
+			strconv.Itoa(len(st.latencies)) + "/" + strconv.Itoa(runs),
+			strconv.FormatFloat(st.mean(), 'f', -1, 64),
+			strconv.FormatFloat(sd, 'f', -1, 64),
+			strconv.FormatFloat(sd*sd, 'f', -1, 64),
+			fmt.Sprintf("%.1f", st.meanRank()),
+			strconv.Itoa(st.rankChange()),
+		})
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("写入CSV文件时出现错误: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// setSocketBuffers 设置套接字的内核收发缓冲区大小，为0时保持系统默认值。
+// 以root运行时使用 SO_RCVBUFFORCE/SO_SNDBUFFORCE 突破 net.core.rmem_max/wmem_max 的限制
+func setSocketBuffers(conn net.PacketConn, rcvbuf, sndbuf int) error {
+	if rcvbuf == 0 && sndbuf == 0 {
+		return nil
+	}
+	raw, err := conn.(syscall.Conn).SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var serr error
+	err = raw.Control(func(fd uintptr) {
+		set := func(force, normal, size int) error {
+			if size == 0 {
+				return nil
+			}
+			if unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, force, size) == nil {
+				return nil
+			}
+			return unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, normal, size)
+		}
+		if serr = set(unix.SO_RCVBUFFORCE, unix.SO_RCVBUF, rcvbuf); serr != nil {
+			serr = fmt.Errorf("无法设置接收缓冲区: %v", serr)
+			return
+		}
+		if serr = set(unix.SO_SNDBUFFORCE, unix.SO_SNDBUF, sndbuf); serr != nil {
+			serr = fmt.Errorf("无法设置发送缓冲区: %v", serr)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
+
+// setBroadcast 开启 SO_BROADCAST，允许向定向广播地址发送请求
+func setBroadcast(conn net.PacketConn) error {
+	raw, err := conn.(syscall.Conn).SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var serr error
+	err = raw.Control(func(fd uintptr) {
+		serr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_BROADCAST, 1)
+	})
+	if err != nil {
+		return err
+	}
+	if serr != nil {
+		return fmt.Errorf("无法开启广播: %v", serr)
+	}
+	return nil
+}
+
+// socketDrops 从 /proc/net/raw 或 raw6 读取内核因接收缓冲区已满而丢弃的报文数
+func socketDrops(conn net.PacketConn) (uint64, bool) {
+	raw, err := conn.(syscall.Conn).SyscallConn()
+	if err != nil {
+		return 0, false
+	}
+	var st unix.Stat_t
+	var serr error
+	if err := raw.Control(func(fd uintptr) { serr = unix.Fstat(int(fd), &st) }); err != nil || serr != nil {
+		return 0, false
+	}
+	inode := strconv.FormatUint(st.Ino, 10)
+
+	var drops uint64
+	found := false
+	// /proc/thread-self/net 反映当前线程所在的网络命名空间，需要在套接字所在的命名空间中读取
+	withNetns(*netns, func() error {
+		for _, name := range []string{"raw", "raw6"} {
+			f, err := os.Open("/proc/thread-self/net/" + name)
+			if err != nil {
+				continue
+			}
+			sc := bufio.NewScanner(f)
+			for sc.Scan() {
+				fields := strings.Fields(sc.Text())
+				if len(fields) >= 13 && fields[9] == inode {
+					drops, _ = strconv.ParseUint(fields[len(fields)-1], 10, 64)
+					found = true
+				}
+			}
+			f.Close()
+		}
+		return nil
+	})
+	return drops, found
+}
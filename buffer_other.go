@@ -0,0 +1,39 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+func setSocketBuffers(conn net.PacketConn, rcvbuf, sndbuf int) error {
+	c, ok := conn.(interface {
+		SetReadBuffer(int) error
+		SetWriteBuffer(int) error
+	})
+	if !ok {
+		return fmt.Errorf("套接字不支持设置缓冲区")
+	}
+	if rcvbuf > 0 {
+		if err := c.SetReadBuffer(rcvbuf); err != nil {
+			return fmt.Errorf("无法设置接收缓冲区: %v", err)
+		}
+	}
+	if sndbuf > 0 {
+		if err := c.SetWriteBuffer(sndbuf); err != nil {
+			return fmt.Errorf("无法设置发送缓冲区: %v", err)
+		}
+	}
+	return nil
+}
+
+// socketDrops 在非Linux系统上无法获取内核丢包计数
+func socketDrops(conn net.PacketConn) (uint64, bool) {
+	return 0, false
+}
+
+// setBroadcast 在非Linux系统上不支持
+func setBroadcast(conn net.PacketConn) error {
+	return fmt.Errorf("当前系统不支持向广播地址发送ICMP请求")
+}
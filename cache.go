@@ -0,0 +1,170 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// cacheBatch 为缓存每次提交的结果数，逐条提交时每个结果都要同步一次磁盘
+const cacheBatch = 256
+
+// resultCache 为 -cache 指定的SQLite结果缓存，按 IP 和扫描器签名保存最近一次成功探测的结果
+type resultCache struct {
+	db        *sql.DB
+	ttl       time.Duration
+	signature string
+
+	mu      sync.Mutex
+	pending []cachedResult
+}
+
+// cachedResult 为缓存中的一条结果，extra 不含标签列和扫描结束后才补充的列
+type cachedResult struct {
+	ip       string
+	probedAt time.Time
+	duration time.Duration
+	rtts     []time.Duration
+	sent     int
+	extra    []string
+}
+
+// openCache 打开或创建缓存数据库，并删除已超过 ttl 的记录
+func openCache(filename string, ttl time.Duration, signature string) (*resultCache, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("-cache-ttl 必须大于0")
+	}
+	db, err := sql.Open("sqlite", filename)
+	if err != nil {
+		return nil, fmt.Errorf("无法打开缓存: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS cache (
+		ip TEXT NOT NULL,
+		signature TEXT NOT NULL,
+		probed_at INTEGER NOT NULL,
+		duration INTEGER NOT NULL,
+		rtts TEXT NOT NULL,
+		sent INTEGER NOT NULL,
+		extra TEXT NOT NULL,
+		PRIMARY KEY (ip, signature)
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("无法创建缓存表: %v", err)
+	}
+	if _, err := db.Exec("DELETE FROM cache WHERE probed_at < ?", time.Now().Add(-ttl).UnixNano()); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("无法清理过期的缓存: %v", err)
+	}
+	return &resultCache{db: db, ttl: ttl, signature: signature}, nil
+}
+
+// split 把目标分为需要探测的和在 ttl 内已成功探测过的，后者直接以缓存的结果返回，标签取自本次输入
+func (c *resultCache) split(list []target) ([]target, []result, error) {
+	rows, err := c.db.Query("SELECT ip, duration, rtts, sent, extra FROM cache WHERE signature = ? AND probed_at >= ?",
+		c.signature, time.Now().Add(-c.ttl).UnixNano())
+	if err != nil {
+		return nil, nil, fmt.Errorf("无法读取缓存: %v", err)
+	}
+	defer rows.Close()
+
+	cached := make(map[string]cachedResult)
+	for rows.Next() {
+		var entry cachedResult
+		var rtts, extra string
+		if err := rows.Scan(&entry.ip, &entry.duration, &rtts, &entry.sent, &extra); err != nil {
+			return nil, nil, fmt.Errorf("无法读取缓存: %v", err)
+		}
+		if json.Unmarshal([]byte(rtts), &entry.rtts) != nil || json.Unmarshal([]byte(extra), &entry.extra) != nil {
+			continue
+		}
+		cached[entry.ip] = entry
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("无法读取缓存: %v", err)
+	}
+
+	var probe []target
+	var results []result
+	for _, t := range list {
+		entry, ok := cached[t.ip]
+		if !ok {
+			probe = append(probe, t)
+			continue
+		}
+		results = append(results, result{
+			ip:       t.ip,
+			latency:  formatLatency(entry.duration),
+			duration: entry.duration,
+			extra:    append(append([]string(nil), t.labels...), entry.extra...),
+			rtts:     entry.rtts,
+			sent:     entry.sent,
+		})
+	}
+	return probe, results, nil
+}
+
+// put 记录一个成功探测的结果，主机名目标的地址可能随解析而变化，不缓存
+func (c *resultCache) put(t target, res result) {
+	if !isAddress(t.ip) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending = append(c.pending, cachedResult{
+		ip:       t.ip,
+		probedAt: time.Now(),
+		duration: res.duration,
+		rtts:     res.rtts,
+		sent:     res.sent,
+		extra:    res.extra[len(t.labels):],
+	})
+	if len(c.pending) >= cacheBatch {
+		c.flushLocked()
+	}
+}
+
+// flushLocked 在一个事务中写入待提交的结果，写入失败只警告，不影响扫描
+func (c *resultCache) flushLocked() {
+	if len(c.pending) == 0 {
+		return
+	}
+	defer func() { c.pending = c.pending[:0] }()
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		slog.Warn("写入缓存失败", "err", err)
+		return
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare("INSERT OR REPLACE INTO cache VALUES (?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		slog.Warn("写入缓存失败", "err", err)
+		return
+	}
+	defer stmt.Close()
+	for _, entry := range c.pending {
+		rtts, _ := json.Marshal(entry.rtts)
+		extra, _ := json.Marshal(entry.extra)
+		if _, err := stmt.Exec(entry.ip, c.signature, entry.probedAt.UnixNano(), int64(entry.duration), string(rtts), entry.sent, string(extra)); err != nil {
+			slog.Warn("写入缓存失败", "ip", entry.ip, "err", err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		slog.Warn("写入缓存失败", "err", err)
+	}
+}
+
+// close 写入剩余的结果并关闭数据库
+func (c *resultCache) close() error {
+	c.mu.Lock()
+	c.flushLocked()
+	c.mu.Unlock()
+	return c.db.Close()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// calibrationRounds 为校准时每个协程在回环地址上收发的次数
+const calibrationRounds = 20
+
+// unreliableOverhead 为并发下本机收发开销的 p90 超过该值时提示计时不可靠
+const unreliableOverhead = time.Millisecond
+
+// calibrate 在回环地址上测量本机收发路径的开销: 先用单个协程测量空闲时的开销，
+// 再用 -max 个协程同时收发，模拟扫描时的调度压力。返回并发时的开销中位数
+func calibrate() (time.Duration, error) {
+	idle, err := loopbackOverhead(1)
+	if err != nil {
+		return 0, err
+	}
+	loaded, err := loopbackOverhead(max(*maxThreads, 1))
+	if err != nil {
+		return 0, err
+	}
+
+	p50, p90 := loaded[len(loaded)/2], loaded[len(loaded)*9/10]
+	slog.Info("测量开销校准", "idle", idle[len(idle)/2], "concurrency", *maxThreads, "p50", p50, "p90", p90)
+	if p90 > unreliableOverhead {
+		slog.Warn("当前并发下本机收发开销过大，延迟测量可能不可靠，建议降低 -max", "p90", p90)
+	}
+	return p50, nil
+}
+
+// loopbackOverhead 用 workers 个协程各自通过一对回环UDP套接字收发报文，
+// 按与探测相同的方式计时，返回升序排列的耗时
+func loopbackOverhead(workers int) ([]time.Duration, error) {
+	var mu sync.Mutex
+	var samples []time.Duration
+	var firstErr error
+
+	// 所有协程准备好后同时开始，使收发真正并发进行
+	var ready, wg sync.WaitGroup
+	start := make(chan struct{})
+	for w := 0; w < workers; w++ {
+		ready.Add(1)
+		wg.Add(1)
+		barrier := sync.OnceFunc(func() {
+			ready.Done()
+			<-start
+		})
+		go func() {
+			defer wg.Done()
+			d, err := loopbackSamples(barrier)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			samples = append(samples, d...)
+		}()
+	}
+	ready.Wait()
+	close(start)
+	wg.Wait()
+
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("无法校准测量开销: %v", firstErr)
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	return samples, nil
+}
+
+// loopbackSamples 创建套接字后调用 barrier 等待其他协程，出错提前返回时也会调用
+func loopbackSamples(barrier func()) ([]time.Duration, error) {
+	defer barrier()
+
+	recv, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	defer recv.Close()
+	send, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	defer send.Close()
+
+	barrier()
+
+	kernelTS := *kernelTime && enableKernelTimestamps(recv)
+	recv.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+	msg := make([]byte, 32)
+	buf := make([]byte, 64)
+	samples := make([]time.Duration, 0, calibrationRounds)
+	for i := 0; i < calibrationRounds; i++ {
+		sent := time.Now()
+		if _, err := send.WriteTo(msg, recv.LocalAddr()); err != nil {
+			return nil, err
+		}
+		_, _, received, err := readTimestamped(recv, buf, kernelTS)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, received.Sub(sent))
+	}
+	return samples, nil
+}
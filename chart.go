@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// 图表的尺寸和颜色。内置的点阵字体只包含ASCII字符，因此图中的文字均为英文
+const (
+	chartWidth   = 800
+	chartMargin  = 20
+	chartRow     = 18 // top 图中每个结果的行高
+	chartHeight  = 400
+	chartBins    = 20 // hist 图的分组数
+	chartCharPix = 7  // 点阵字体的字符宽度
+)
+
+var (
+	chartBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	chartBar        = color.RGBA{0x4c, 0x78, 0xa8, 0xff}
+	chartText       = color.RGBA{0x33, 0x33, 0x33, 0xff}
+	chartAxis       = color.RGBA{0x99, 0x99, 0x99, 0xff}
+	chartMarker     = color.RGBA{0xe4, 0x57, 0x56, 0xff}
+)
+
+// validateChart 检查 -chart 的文件名和图表类型
+func validateChart() error {
+	if *chartFile == "" {
+		return nil
+	}
+	if strings.ToLower(filepath.Ext(*chartFile)) != ".png" {
+		return fmt.Errorf("-chart 目前只支持输出PNG文件")
+	}
+	if *chartType != "top" && *chartType != "hist" {
+		return fmt.Errorf("未知的图表类型: %s，可用 top 或 hist", *chartType)
+	}
+	if *chartN < 1 {
+		return fmt.Errorf("-chart-n 必须大于0")
+	}
+	return nil
+}
+
+// writeChart 按 -chart-type 把结果画成PNG图片: top 为排在最前的 -chart-n 个结果的延迟横向柱状图，
+// hist 为全部结果的延迟分布直方图并标出 P50、P90 和 P99
+func writeChart(filename string, results []result) error {
+	var img *image.RGBA
+	if *chartType == "top" {
+		img = topChart(results[:min(*chartN, len(results))])
+	} else {
+		img = histChart(results)
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("无法创建文件: %v", err)
+	}
+	defer file.Close()
+	if err := png.Encode(file, img); err != nil {
+		return fmt.Errorf("无法写入图片: %v", err)
+	}
+	slog.Info("成功将图表写入文件", "file", filename, "type", *chartType, "results", len(results))
+	return nil
+}
+
+// topChart 每行一个结果，左侧为IP，柱长与延迟成正比，柱后为延迟值
+func topChart(results []result) *image.RGBA {
+	labelWidth := 0
+	var longest time.Duration
+	for _, res := range results {
+		labelWidth = max(labelWidth, len(res.ip)*chartCharPix)
+		longest = max(longest, res.duration)
+	}
+	height := 2*chartMargin + chartRow*(len(results)+1)
+	img := newCanvas(chartWidth, height)
+	drawText(img, chartMargin, chartMargin+12, fmt.Sprintf("latency of top %d results", len(results)), chartText)
+
+	left := chartMargin + labelWidth + 8
+	span := chartWidth - left - chartMargin - 8*chartCharPix
+	for i, res := range results {
+		y := chartMargin + chartRow*(i+1)
+		drawText(img, chartMargin, y+12, res.ip, chartText)
+		w := 1
+		if longest > 0 {
+			w = max(int(float64(span)*float64(res.duration)/float64(longest)), 1)
+		}
+		fillRect(img, left, y+3, w, chartRow-6, chartBar)
+		drawText(img, left+w+4, y+12, formatMillis(res.duration), chartText)
+	}
+	return img
+}
+
+// histChart 把延迟范围等分为 chartBins 组画出每组的结果数，竖线标出P50、P90和P99
+func histChart(results []result) *image.RGBA {
+	img := newCanvas(chartWidth, chartHeight)
+	ms := make([]float64, len(results))
+	for i, res := range results {
+		ms[i] = float64(res.duration) / 1e6
+	}
+	slices.Sort(ms)
+	drawText(img, chartMargin, chartMargin+12, fmt.Sprintf("latency distribution (%d results)", len(ms)), chartText)
+	if len(ms) == 0 {
+		return img
+	}
+
+	low, high := ms[0], ms[len(ms)-1]
+	width := (high - low) / chartBins
+	if width == 0 {
+		width = 1
+	}
+	counts := make([]int, chartBins)
+	for _, v := range ms {
+		counts[min(int((v-low)/width), chartBins-1)]++
+	}
+	peak := slices.Max(counts)
+
+	left, top := chartMargin+6*chartCharPix, chartMargin+24
+	bottom, right := chartHeight-chartMargin-16, chartWidth-chartMargin
+	plotW, plotH := right-left, bottom-top
+	fillRect(img, left, bottom, plotW, 1, chartAxis)
+	fillRect(img, left, top, 1, plotH, chartAxis)
+	drawText(img, chartMargin, top+10, strconv.Itoa(peak), chartText)
+	drawText(img, chartMargin, bottom, "0", chartText)
+
+	barW := plotW / chartBins
+	for i, n := range counts {
+		h := plotH * n / peak
+		fillRect(img, left+i*barW+1, bottom-h, barW-2, h, chartBar)
+	}
+
+	// x 轴的位置按延迟线性换算
+	xOf := func(v float64) int {
+		if high == low {
+			return left
+		}
+		return left + int(float64(plotW)*(v-low)/(high-low))
+	}
+	drawText(img, left, bottom+14, strconv.FormatFloat(low, 'f', 1, 64)+" ms", chartText)
+	hi := strconv.FormatFloat(high, 'f', 1, 64) + " ms"
+	drawText(img, right-len(hi)*chartCharPix, bottom+14, hi, chartText)
+	for i, p := range []int{50, 90, 99} {
+		x := xOf(percentile(ms, p))
+		fillRect(img, x, top, 1, plotH, chartMarker)
+		label := fmt.Sprintf("p%d", p)
+		// 靠近右边缘的标记把文字写在竖线左侧
+		lx := x + 3
+		if lx+len(label)*chartCharPix > right {
+			lx = x - 3 - len(label)*chartCharPix
+		}
+		drawText(img, lx, top+12+14*i, label, chartMarker)
+	}
+	return img
+}
+
+func newCanvas(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(chartBackground), image.Point{}, draw.Src)
+	return img
+}
+
+func fillRect(img *image.RGBA, x, y, w, h int, c color.Color) {
+	draw.Draw(img, image.Rect(x, y, x+w, y+h), image.NewUniform(c), image.Point{}, draw.Src)
+}
+
+// drawText 以 (x, y) 为基线起点写一行ASCII文字
+func drawText(img *image.RGBA, x, y int, s string, c color.Color) {
+	d := font.Drawer{Dst: img, Src: image.NewUniform(c), Face: basicfont.Face7x13, Dot: fixed.P(x, y)}
+	d.DrawString(s)
+}
+
+// formatMillis 以保留一位小数的毫秒数显示延迟，亚毫秒的延迟在图中也能区分
+func formatMillis(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/1e6, 'f', 1, 64) + " ms"
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// check 子命令的退出码，2 与 flag 包解析参数失败时的退出码一致
+const (
+	checkHealthy   = 0
+	checkUnhealthy = 1
+	checkUsage     = 2
+)
+
+// runCheck 实现 check 子命令: 对单个目标探测 -count 次，按成功次数和平均延迟判定健康状态，
+// 通过退出码返回结果，可直接作为容器的存活探针使用
+func runCheck(args []string) {
+	// -count 与扫描共用同一个参数，check 默认探测3次
+	*probeCount = 3
+	flag.Lookup("count").DefValue = "3"
+	minSuccess := flag.Int("min-success", 1, "判定为健康所需的最少成功次数")
+	// -max-latency 与扫描的 -stop-after 共用，check 中为成功探测的平均延迟上限
+	flag.Lookup("max-latency").Usage = "成功探测的平均延迟上限，为0时不限制"
+
+	// 目标可以写在参数之前，如 check 1.2.3.4 -count 3
+	var ip string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		ip, args = args[0], args[1:]
+	}
+	flag.CommandLine.Parse(args)
+	if ip == "" {
+		ip = flag.Arg(0)
+	}
+
+	if err := setupLogging(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(checkUsage)
+	}
+	if ip == "" || !validTarget(ip) {
+		slog.Error("请指定一个有效的目标IP或域名", "target", ip)
+		os.Exit(checkUsage)
+	}
+	if *probeCount < 1 || *minSuccess < 1 || *minSuccess > *probeCount {
+		slog.Error("探测次数必须大于0，且最少成功次数在 1 到探测次数之间")
+		os.Exit(checkUsage)
+	}
+
+	s, err := newScanner()
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(checkUsage)
+	}
+
+	var ok int
+	var total time.Duration
+	for i := 0; i < *probeCount; i++ {
+		duration, _, err := s.probe(ip, s.pool.pick(i, ip), *timeout)
+		if err != nil {
+			slog.Debug("探测失败", "ip", ip, "attempt", i+1, "err", err)
+			continue
+		}
+		slog.Debug("探测成功", "ip", ip, "attempt", i+1, "latency", formatLatency(duration))
+		ok++
+		total += duration
+	}
+
+	healthy := ok >= *minSuccess
+	var avg time.Duration
+	if ok > 0 {
+		avg = total / time.Duration(ok)
+		if *maxLatency > 0 && avg > *maxLatency {
+			healthy = false
+		}
+	}
+
+	verdict := "健康"
+	if !healthy {
+		verdict = "不健康"
+	}
+	fmt.Printf("%s %s: 成功 %d/%d，平均延迟 %s\n", ip, verdict, ok, *probeCount, formatLatency(avg))
+	if !healthy {
+		os.Exit(checkUnhealthy)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// cloudSources 为各云服务商公布的IP范围文件，Azure 的下载地址每周变化，需要通过 -cloud-ranges 指定
+var cloudSources = map[string]string{
+	"aws":        "https://ip-ranges.amazonaws.com/ip-ranges.json",
+	"gcp":        "https://www.gstatic.com/ipranges/cloud.json",
+	"cloudflare": "https://www.cloudflare.com/ips-v4,https://www.cloudflare.com/ips-v6",
+}
+
+// cloudCacheTTL 为下载的范围文件在本地缓存的有效期
+const cloudCacheTTL = 24 * time.Hour
+
+type cloudRange struct {
+	provider string
+	region   string
+}
+
+// cloudIndex 按前缀长度分组保存范围，查找时从最长前缀开始匹配
+type cloudIndex struct {
+	byBits map[int]map[netip.Prefix]cloudRange
+	bits   []int
+}
+
+func (idx *cloudIndex) add(prefix, provider, region string) {
+	p, err := netip.ParsePrefix(strings.TrimSpace(prefix))
+	if err != nil {
+		return
+	}
+	p = p.Masked()
+	if r, ok := idx.byBits[p.Bits()][p]; ok && r.region != "" && region == "" {
+		// 同一前缀出现多次时(如 Azure 的多个服务标签)保留带区域的条目
+		return
+	}
+	m, ok := idx.byBits[p.Bits()]
+	if !ok {
+		m = make(map[netip.Prefix]cloudRange)
+		idx.byBits[p.Bits()] = m
+		idx.bits = append(idx.bits, p.Bits())
+		sort.Sort(sort.Reverse(sort.IntSlice(idx.bits)))
+	}
+	m[p] = cloudRange{provider, region}
+}
+
+func (idx *cloudIndex) lookup(ip string) (cloudRange, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return cloudRange{}, false
+	}
+	for _, bits := range idx.bits {
+		p, err := addr.Prefix(bits)
+		if err != nil {
+			continue
+		}
+		if r, ok := idx.byBits[bits][p]; ok {
+			return r, true
+		}
+	}
+	return cloudRange{}, false
+}
+
+// loadCloudIndex 加载各云服务商的范围文件，overrides 为 provider=路径或URL 的逗号分隔列表
+func loadCloudIndex(overrides string) (*cloudIndex, error) {
+	sources := make(map[string][]string)
+	for provider, src := range cloudSources {
+		sources[provider] = strings.Split(src, ",")
+	}
+	for _, item := range strings.Split(overrides, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		provider, src, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("无效的范围文件配置: %s", item)
+		}
+		sources[provider] = []string{src}
+	}
+
+	idx := &cloudIndex{byBits: make(map[int]map[netip.Prefix]cloudRange)}
+	for provider, srcs := range sources {
+		for _, src := range srcs {
+			data, err := loadRangeFile(src)
+			if err != nil {
+				// 单个服务商下载失败时跳过，不影响其余服务商的标注
+				slog.Warn("无法加载IP范围", "provider", provider, "err", err)
+				continue
+			}
+			if err := parseRanges(idx, provider, data); err != nil {
+				return nil, fmt.Errorf("无法解析 %s 的IP范围: %v", provider, err)
+			}
+		}
+	}
+
+	return idx, nil
+}
+
+// loadRangeFile 读取本地文件，或下载URL并在用户缓存目录中缓存
+func loadRangeFile(src string) ([]byte, error) {
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		return os.ReadFile(src)
+	}
+
+	var cachePath string
+	if dir, err := os.UserCacheDir(); err == nil {
+		name := strings.NewReplacer("://", "_", "/", "_").Replace(src)
+		cachePath = filepath.Join(dir, "icmp-scan", name)
+		if info, err := os.Stat(cachePath); err == nil && time.Since(info.ModTime()) < cloudCacheTTL {
+			return os.ReadFile(cachePath)
+		}
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(src)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("下载 %s 返回 %s", src, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if cachePath != "" && os.MkdirAll(filepath.Dir(cachePath), 0o755) == nil {
+		os.WriteFile(cachePath, data, 0o644)
+	}
+	return data, nil
+}
+
+// parseRanges 识别 AWS、GCP、Azure 的JSON格式，其余按每行一个CIDR的纯文本处理
+func parseRanges(idx *cloudIndex, provider string, data []byte) error {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			idx.add(scanner.Text(), provider, "")
+		}
+		return scanner.Err()
+	}
+
+	var doc struct {
+		// AWS 与 GCP 都使用 prefixes 字段，但前缀和区域的字段名不同
+		Prefixes []struct {
+			IPPrefix   string `json:"ip_prefix"`
+			Region     string `json:"region"`
+			IPv4Prefix string `json:"ipv4Prefix"`
+			IPv6Prefix string `json:"ipv6Prefix"`
+			Scope      string `json:"scope"`
+		} `json:"prefixes"`
+		IPv6Prefixes []struct {
+			IPv6Prefix string `json:"ipv6_prefix"`
+			Region     string `json:"region"`
+		} `json:"ipv6_prefixes"`
+		// Azure Service Tags
+		Values []struct {
+			Properties struct {
+				Region          string   `json:"region"`
+				AddressPrefixes []string `json:"addressPrefixes"`
+			} `json:"properties"`
+		} `json:"values"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	for _, p := range doc.Prefixes {
+		region := p.Region
+		if region == "" {
+			region = p.Scope
+		}
+		for _, prefix := range []string{p.IPPrefix, p.IPv4Prefix, p.IPv6Prefix} {
+			if prefix != "" {
+				idx.add(prefix, provider, region)
+			}
+		}
+	}
+	for _, p := range doc.IPv6Prefixes {
+		idx.add(p.IPv6Prefix, provider, p.Region)
+	}
+	for _, v := range doc.Values {
+		for _, prefix := range v.Properties.AddressPrefixes {
+			idx.add(prefix, provider, v.Properties.Region)
+		}
+	}
+
+	return nil
+}
+
+// enrichCloud 为每个结果追加云服务商和区域两列
+func enrichCloud(results []result, idx *cloudIndex) {
+	for i := range results {
+		r, _ := idx.lookup(results[i].ip)
+		results[i].extra = append(results[i].extra, r.provider, r.region)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// fetchColo 请求 /cdn-cgi/trace 并提取其中的 colo 字段，即该IP实际落到的Cloudflare数据中心
+func fetchColo(ip, src string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, "http://"+urlHost(ip, "80")+"/cdn-cgi/trace", nil)
+	if err != nil {
+		return "", err
+	}
+	if *hostHeader != "" {
+		req.Host = *hostHeader
+	}
+
+	client := &http.Client{
+		Timeout: *timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dialTarget(ctx, src, addr)
+			},
+			DisableKeepAlives: true,
+		},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("状态码 %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "colo="); ok {
+			return value, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", fmt.Errorf("响应中没有 colo 字段")
+}
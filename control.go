@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pauseGate 在暂停期间阻塞工作协程发起新的探测，已发出的探测照常完成
+type pauseGate struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	paused bool
+}
+
+func newPauseGate() *pauseGate {
+	g := &pauseGate{}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+func (g *pauseGate) wait() {
+	g.mu.Lock()
+	for g.paused {
+		g.cond.Wait()
+	}
+	g.mu.Unlock()
+}
+
+// set 暂停或恢复，返回之前是否处于暂停状态
+func (g *pauseGate) set(paused bool) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	was := g.paused
+	g.paused = paused
+	if !paused {
+		g.cond.Broadcast()
+	}
+	return was
+}
+
+func (g *pauseGate) isPaused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused
+}
+
+// setPaused 暂停或恢复发起新的探测，状态改变时记录当前进度
+func (s *scanner) setPaused(paused bool) {
+	if s.gate.set(paused) == paused {
+		return
+	}
+	if paused {
+		slog.Info("扫描已暂停", "done", s.done.Load(), "total", s.total.Load())
+	} else {
+		slog.Info("扫描已恢复", "done", s.done.Load(), "total", s.total.Load())
+	}
+}
+
+// targetFeed 保存扫描过程中追加的目标，在输入的目标全部分发后依次交给扫描。
+// 全部目标都已探测完、追加队列也为空后扫描结束，不再接受追加
+type targetFeed struct {
+	mu          sync.Mutex
+	pending     []target
+	closed      bool
+	seen        map[string]bool
+	added       []target      // 本次扫描中追加的全部目标，供写出无响应列表等使用
+	done, total *atomic.Int64 // 扫描的进度，追加的目标计入 total
+}
+
+// enableFeed 使扫描接受追加的目标，供 -control 和 -watch 使用
+func (s *scanner) enableFeed() {
+	if s.feed == nil {
+		s.feed = &targetFeed{done: &s.done, total: &s.total}
+	}
+}
+
+// begin 为一次新的扫描重置状态，list 中已有的目标不会被重复追加
+func (f *targetFeed) begin(list []target) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pending, f.added, f.closed = nil, nil, false
+	f.seen = make(map[string]bool, len(list))
+	for _, t := range list {
+		f.seen[t.ip] = true
+	}
+}
+
+// add 把目标加入追加队列，返回实际加入的数量和因 -max-targets 被截断的数量，已在本次扫描中的目标被忽略。
+// 追加后的目标总数超过 -max-targets 时拒绝整批追加，设置了 -truncate 时只加入不超过上限的部分
+func (f *targetFeed) add(targets []target) (int, int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed || f.seen == nil {
+		return 0, 0, errors.New("当前没有可追加目标的扫描")
+	}
+	var fresh []target
+	batch := make(map[string]bool)
+	for _, t := range targets {
+		if f.seen[t.ip] || batch[t.ip] {
+			continue
+		}
+		batch[t.ip] = true
+		fresh = append(fresh, t)
+	}
+	dropped := 0
+	if *maxTargets > 0 {
+		room := max(*maxTargets-int(f.total.Load()), 0)
+		if len(fresh) > room {
+			if !*truncateTargets {
+				return 0, 0, fmt.Errorf("追加后目标总数将超过 -max-targets %d，可使用 -truncate 截断", *maxTargets)
+			}
+			dropped = len(fresh) - room
+			fresh = fresh[:room]
+		}
+	}
+	for _, t := range fresh {
+		f.seen[t.ip] = true
+		f.pending = append(f.pending, t)
+		f.added = append(f.added, t)
+	}
+	f.total.Add(int64(len(fresh)))
+	return len(fresh), dropped, nil
+}
+
+// drain 把追加队列中的目标通过 s.dispatch 发送到 targets。队列为空时等待已分发的目标探测完，
+// 期间追加的目标继续发送，全部探测完或扫描被停止后返回
+func (f *targetFeed) drain(s *scanner, targets chan<- target) {
+	for {
+		f.mu.Lock()
+		batch := f.pending
+		f.pending = nil
+		if len(batch) == 0 && f.done.Load() >= f.total.Load() {
+			f.closed = true
+		}
+		closed := f.closed
+		f.mu.Unlock()
+		if closed {
+			return
+		}
+		if len(batch) == 0 {
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		if !s.dispatch(targets, batch) {
+			f.mu.Lock()
+			f.closed = true
+			f.mu.Unlock()
+			return
+		}
+	}
+}
+
+// controlRequest 为 -control 套接字上每行一个的JSON命令
+type controlRequest struct {
+	Cmd     string   `json:"cmd"`
+	Rate    *float64 `json:"rate,omitempty"`
+	Targets []string `json:"targets,omitempty"`
+	N       *int     `json:"n,omitempty"`
+}
+
+// controlResponse 为对每条命令的JSON应答，只包含与命令相关的字段
+type controlResponse struct {
+	OK      bool              `json:"ok"`
+	Error   string            `json:"error,omitempty"`
+	Paused  *bool             `json:"paused,omitempty"`
+	Done    *int64            `json:"done,omitempty"`
+	Total   *int64            `json:"total,omitempty"`
+	Alive   *int              `json:"alive,omitempty"`
+	Rate    *float64          `json:"rate,omitempty"`
+	Added   *int              `json:"added,omitempty"`
+	Dropped *int              `json:"dropped,omitempty"`
+	Results []json.RawMessage `json:"results,omitempty"`
+}
+
+// controlCommands 为 -control 支持的命令
+var controlCommands = map[string]func(s *scanner, req controlRequest) (controlResponse, error){
+	"status":  controlStatus,
+	"pause":   controlPause,
+	"resume":  controlResume,
+	"rate":    controlRate,
+	"add":     controlAdd,
+	"results": controlResults,
+	"top":     controlTop,
+	"stop":    controlStop,
+}
+
+// startControl 在 -control 指定的Unix套接字上接受JSON命令，用于在扫描过程中暂停、恢复、调整速率、
+// 追加目标、获取已收到的结果或当前最快的结果，以及提前结束扫描。返回的函数关闭监听并删除套接字文件
+func startControl(s *scanner) (func(), error) {
+	if *controlSocket == "" {
+		return func() {}, nil
+	}
+	// 上次异常退出遗留的套接字文件会使监听失败
+	if info, err := os.Stat(*controlSocket); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(*controlSocket)
+	}
+	ln, err := net.Listen("unix", *controlSocket)
+	if err != nil {
+		return nil, fmt.Errorf("无法监听控制套接字: %v", err)
+	}
+	s.enableFeed()
+	slog.Info("控制接口已启动", "socket", *controlSocket)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveControl(s, conn)
+		}
+	}()
+	return func() { ln.Close() }, nil
+}
+
+// serveControl 逐行读取命令并逐行写回应答，直到连接关闭
+func serveControl(s *scanner, conn net.Conn) {
+	defer conn.Close()
+	in := bufio.NewScanner(conn)
+	in.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	encoder := json.NewEncoder(conn)
+	for in.Scan() {
+		if strings.TrimSpace(in.Text()) == "" {
+			continue
+		}
+		var req controlRequest
+		var resp controlResponse
+		if err := json.Unmarshal(in.Bytes(), &req); err != nil {
+			resp.Error = fmt.Sprintf("无法解析命令: %v", err)
+		} else if cmd, ok := controlCommands[req.Cmd]; !ok {
+			resp.Error = fmt.Sprintf("未知的命令: %s，可用的命令: %s", req.Cmd, strings.Join(controlNames(), ", "))
+		} else if resp, err = cmd(s, req); err != nil {
+			resp = controlResponse{Error: err.Error()}
+		} else {
+			resp.OK = true
+		}
+		if encoder.Encode(resp) != nil {
+			return
+		}
+	}
+}
+
+func controlNames() []string {
+	names := make([]string, 0, len(controlCommands))
+	for name := range controlCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func controlStatus(s *scanner, req controlRequest) (controlResponse, error) {
+	paused, done, total, rate := s.gate.isPaused(), s.done.Load(), s.total.Load(), s.limiter.rate()
+	s.mu.Lock()
+	alive := len(s.collected)
+	s.mu.Unlock()
+	return controlResponse{Paused: &paused, Done: &done, Total: &total, Alive: &alive, Rate: &rate}, nil
+}
+
+func controlPause(s *scanner, req controlRequest) (controlResponse, error) {
+	s.setPaused(true)
+	paused := true
+	return controlResponse{Paused: &paused}, nil
+}
+
+func controlResume(s *scanner, req controlRequest) (controlResponse, error) {
+	s.setPaused(false)
+	paused := false
+	return controlResponse{Paused: &paused}, nil
+}
+
+// controlRate 修改 -rate，为0时取消限速
+func controlRate(s *scanner, req controlRequest) (controlResponse, error) {
+	if req.Rate == nil || *req.Rate < 0 {
+		return controlResponse{}, errors.New("rate 命令需要不小于0的 rate 字段")
+	}
+	s.limiter.set(*req.Rate)
+	slog.Info("已调整探测速率", "rate", *req.Rate)
+	rate := s.limiter.rate()
+	return controlResponse{Rate: &rate}, nil
+}
+
+// controlAdd 把IP、主机名或CIDR追加到正在进行的扫描，追加的目标标签列为空
+func controlAdd(s *scanner, req controlRequest) (controlResponse, error) {
+	var targets []target
+	cut := 0 // 超出展开上限而未展开的CIDR地址数，计入被截断的数量
+	for _, spec := range req.Targets {
+		spec = strings.TrimSpace(spec)
+		var ips []string
+		if strings.Contains(spec, "/") {
+			var err error
+			// 多展开一个，超过 -max-targets 时由 add 拒绝或截断
+			limit := *maxTargets + 1
+			if *maxTargets <= 0 {
+				limit = -1
+			}
+			if ips, err = expandCIDR(spec, limit); err != nil {
+				return controlResponse{}, fmt.Errorf("无法解析CIDR: %s", spec)
+			}
+			_, ipnet, _ := net.ParseCIDR(spec)
+			cut += int(cidrHosts(ipnet) - uint64(len(ips)))
+		} else if validTarget(spec) {
+			ips = []string{spec}
+		} else {
+			return controlResponse{}, fmt.Errorf("无效的IP或主机名: %s", spec)
+		}
+		for _, ip := range ips {
+			labels := make([]string, s.labels)
+			if *originColumn && s.labels > 0 {
+				labels[s.labels-1] = spec
+			}
+			targets = append(targets, target{ip: ip, labels: labels, origin: spec})
+		}
+	}
+	if s.feed == nil {
+		return controlResponse{}, errors.New("当前没有可追加目标的扫描")
+	}
+	n, dropped, err := s.feed.add(targets)
+	if err != nil {
+		return controlResponse{}, err
+	}
+	resp := controlResponse{Added: &n}
+	if dropped > 0 {
+		dropped += cut
+		slog.Warn("目标数量超过 -max-targets，已截断", "max", *maxTargets, "dropped", dropped)
+		resp.Dropped = &dropped
+	}
+	slog.Info("已追加目标", "added", n, "total", s.total.Load())
+	return resp, nil
+}
+
+// controlResults 返回本次扫描到目前为止收到的结果，尚未经过扫描结束后的排序和补充列
+func controlResults(s *scanner, req controlRequest) (controlResponse, error) {
+	s.mu.Lock()
+	results := append([]result(nil), s.collected...)
+	s.mu.Unlock()
+	// 补充列在扫描结束后才追加，columns 中只取结果已有的部分
+	resp := controlResponse{Results: make([]json.RawMessage, 0, len(results))}
+	for _, res := range results {
+		resp.Results = append(resp.Results, resultJSON(res, s.columns[:len(res.extra)]))
+	}
+	return resp, nil
+}
+
+// controlTop 返回到目前为止延迟最低的 n 个结果，未指定 n 时为 -leaderboard-n
+func controlTop(s *scanner, req controlRequest) (controlResponse, error) {
+	n := *leaderboardN
+	if req.N != nil {
+		n = *req.N
+	}
+	if n < 1 {
+		return controlResponse{}, errors.New("n 必须大于0")
+	}
+	resp := controlResponse{Results: []json.RawMessage{}}
+	for _, res := range s.topResults(n) {
+		resp.Results = append(resp.Results, resultJSON(res, s.columns[:len(res.extra)]))
+	}
+	return resp, nil
+}
+
+// controlStop 停止派发新的目标，已发出的探测完成后扫描照常结束并输出已收到的结果
+func controlStop(s *scanner, req controlRequest) (controlResponse, error) {
+	s.halt("control")
+	done, total := s.done.Load(), s.total.Load()
+	return controlResponse{Done: &done, Total: &total}, nil
+}
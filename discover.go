@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// discover 向定向广播或组播地址发送一个回显请求，把 -timeout 内应答的每个主机作为一条结果，
+// 用于快速发现本地网络中的主机。IPv6 链路本地组播地址需要用区域指定接口，如 ff02::1%eth0
+func (s *scanner) discover(group string) ([]result, error) {
+	dst, err := net.ResolveIPAddr("ip", group)
+	if err != nil {
+		return nil, fmt.Errorf("解析广播或组播地址失败: %v", err)
+	}
+
+	network, proto := "ip4:icmp", 1
+	var msgType icmp.Type = ipv4.ICMPTypeEcho
+	src := s.pool.pick(0, dst.IP.String())
+	if dst.IP.To4() == nil {
+		network, proto, msgType = "ip6:ipv6-icmp", 58, ipv6.ICMPTypeEchoRequest
+		if src == "" {
+			src = "::"
+		}
+	} else if src == "" {
+		src = "0.0.0.0"
+	}
+
+	conn, err := listen(network, src)
+	if err != nil {
+		return nil, fmt.Errorf("创建ICMP连接失败: %v", err)
+	}
+	defer conn.Close()
+	if dst.IP.To4() != nil && !dst.IP.IsMulticast() {
+		if err := setBroadcast(conn); err != nil {
+			return nil, err
+		}
+	}
+	kernelTS := *kernelTime && enableKernelTimestamps(conn)
+
+	id, seq := icmpID(), int(time.Now().UnixNano()&0xffff)
+	wm := icmp.Message{
+		Type: msgType,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: echoPayload()},
+	}
+	wb, err := wm.Marshal(nil)
+	if err != nil {
+		return nil, fmt.Errorf("序列化ICMP消息失败: %v", err)
+	}
+
+	slog.Info("正在发现主机", "group", group, "window", timeout.String())
+	start := time.Now()
+	if _, err := conn.WriteTo(wb, dst); err != nil {
+		return nil, fmt.Errorf("发送ICMP请求失败: %v", err)
+	}
+	var local net.IP
+	if capture != nil {
+		local = routeSource(dst.IP, src)
+		capture.writeICMP(start, local, dst.IP, wb)
+	}
+
+	conn.SetReadDeadline(start.Add(*timeout))
+	seen := make(map[string]bool)
+	var results []result
+	buf := make([]byte, 1500)
+	for {
+		n, peer, at, err := readTimestamped(conn, buf, kernelTS)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				break
+			}
+			return nil, fmt.Errorf("接收ICMP回复失败: %v", err)
+		}
+		m, ok := matchEcho(proto, buf[:n])
+		if !ok || m.target != nil || m.extended || m.id != id || m.seq != seq || !ownEcho(m) {
+			continue
+		}
+
+		// 链路本地地址的应答者保留区域，如 fe80::1%eth0
+		addr := peer.(*net.IPAddr)
+		if seen[addr.String()] {
+			continue
+		}
+		seen[addr.String()] = true
+		if capture != nil {
+			capture.writeICMP(at, addr.IP, local, buf[:n])
+		}
+
+		res := s.newResult(target{ip: addr.String()}, src, []time.Duration{at.Sub(start)}, 1, nil)
+		slog.Debug("发现主机", "ip", res.ip, "latency", res.latency)
+		for _, sink := range s.sinks {
+			if err := sink.send(res, s.columns); err != nil {
+				slog.Warn("推送结果失败", "ip", res.ip, "err", err)
+			}
+		}
+		results = append(results, res)
+	}
+
+	s.probed = int64(len(results))
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].duration < results[j].duration
+	})
+	s.enrich(results)
+	return results, nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dnsProviders 为 -dns-update 支持的服务商，update 把记录的每种类型 (A/AAAA) 替换为给定的地址
+var dnsProviders = map[string]struct {
+	validate func() error
+	update   func(name string, records map[string][]string) error
+}{
+	"cloudflare": {validateCloudflare, updateCloudflare},
+	"route53":    {validateRoute53, updateRoute53},
+	"rfc2136":    {validateRFC2136, updateRFC2136},
+}
+
+var dnsClient = &http.Client{Timeout: 30 * time.Second}
+
+// validateDNSUpdate 在扫描开始前检查 -dns-update 相关参数和凭据，避免扫描结束后才发现无法更新
+func validateDNSUpdate() error {
+	if *dnsProvider == "" {
+		return nil
+	}
+	p, ok := dnsProviders[*dnsProvider]
+	if !ok {
+		return fmt.Errorf("未知的DNS服务商: %s", *dnsProvider)
+	}
+	if *dnsRecord == "" {
+		return fmt.Errorf("-dns-update 需要用 -dns-record 指定要更新的记录")
+	}
+	if *selectN < 1 {
+		return fmt.Errorf("-n 必须大于0")
+	}
+	return p.validate()
+}
+
+// updateDNS 把 -dns-record 更新为延迟最低的前 -n 个有响应地址，IPv4和IPv6地址分别写入A和AAAA记录，
+// 结果中没有的地址族保持不变。没有任何结果时不修改记录
+func updateDNS(results []result) error {
+	if *dnsProvider == "" {
+		return nil
+	}
+	if len(results) == 0 {
+		slog.Warn("没有有响应的地址，未更新DNS记录", "record", *dnsRecord)
+		return nil
+	}
+
+	// 主机名目标和带区域的链路本地地址无法写入记录
+	records := make(map[string][]string)
+	for i := 0; i < len(results) && len(records["A"])+len(records["AAAA"]) < *selectN; i++ {
+		addr, err := netip.ParseAddr(results[i].ip)
+		if err != nil || addr.Zone() != "" {
+			continue
+		}
+		typ := "A"
+		if addr.Is6() && !addr.Is4In6() {
+			typ = "AAAA"
+		}
+		records[typ] = append(records[typ], addr.Unmap().String())
+	}
+	if len(records) == 0 {
+		slog.Warn("没有可写入DNS记录的地址，未更新DNS记录", "record", *dnsRecord)
+		return nil
+	}
+
+	if err := dnsProviders[*dnsProvider].update(strings.TrimSuffix(*dnsRecord, "."), records); err != nil {
+		return fmt.Errorf("更新DNS记录失败: %v", err)
+	}
+	for _, typ := range recordTypes(records) {
+		slog.Info("已更新DNS记录", "provider", *dnsProvider, "record", *dnsRecord, "type", typ, "addrs", strings.Join(records[typ], ","))
+	}
+	return nil
+}
+
+// recordTypes 按固定顺序返回要更新的记录类型
+func recordTypes(records map[string][]string) []string {
+	types := make([]string, 0, len(records))
+	for typ := range records {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// cloudflareAPI 返回 Cloudflare API 的地址，可用 -dns-endpoint 覆盖
+func cloudflareAPI() string {
+	if *dnsEndpoint != "" {
+		return strings.TrimSuffix(*dnsEndpoint, "/")
+	}
+	return "https://api.cloudflare.com/client/v4"
+}
+
+func validateCloudflare() error {
+	if os.Getenv("CLOUDFLARE_API_TOKEN") == "" {
+		return fmt.Errorf("请通过环境变量 CLOUDFLARE_API_TOKEN 提供 Cloudflare API 令牌")
+	}
+	return nil
+}
+
+// cloudflareCall 调用 Cloudflare API 并把响应中的 result 解析到 out
+func cloudflareCall(method, path string, body any, out any) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, cloudflareAPI()+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+os.Getenv("CLOUDFLARE_API_TOKEN"))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := dnsClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var envelope struct {
+		Success bool `json:"success"`
+		Errors  []struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("无法解析 Cloudflare 响应 (HTTP %d): %v", resp.StatusCode, err)
+	}
+	if !envelope.Success {
+		var msgs []string
+		for _, e := range envelope.Errors {
+			msgs = append(msgs, fmt.Sprintf("%d %s", e.Code, e.Message))
+		}
+		return fmt.Errorf("Cloudflare API 返回错误 (HTTP %d): %s", resp.StatusCode, strings.Join(msgs, "; "))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(envelope.Result, out)
+}
+
+// cloudflareZone 返回 -dns-zone 指定的区域ID，未指定时从记录名开始逐级向上查找所属的区域
+func cloudflareZone(name string) (string, error) {
+	if *dnsZone != "" {
+		return *dnsZone, nil
+	}
+	labels := strings.Split(name, ".")
+	for i := 0; i < len(labels)-1; i++ {
+		var zones []struct {
+			ID string `json:"id"`
+		}
+		candidate := strings.Join(labels[i:], ".")
+		if err := cloudflareCall("GET", "/zones?name="+url.QueryEscape(candidate), nil, &zones); err != nil {
+			return "", err
+		}
+		if len(zones) > 0 {
+			return zones[0].ID, nil
+		}
+	}
+	return "", fmt.Errorf("找不到记录 %s 所属的 Cloudflare 区域", name)
+}
+
+// updateCloudflare 删除记录中不再需要的地址并添加缺少的地址
+func updateCloudflare(name string, records map[string][]string) error {
+	zone, err := cloudflareZone(name)
+	if err != nil {
+		return err
+	}
+
+	for _, typ := range recordTypes(records) {
+		ips := records[typ]
+		var existing []struct {
+			ID      string `json:"id"`
+			Content string `json:"content"`
+		}
+		query := url.Values{"type": {typ}, "name": {name}, "per_page": {"100"}}
+		if err := cloudflareCall("GET", "/zones/"+zone+"/dns_records?"+query.Encode(), nil, &existing); err != nil {
+			return err
+		}
+
+		want := make(map[string]bool, len(ips))
+		for _, ip := range ips {
+			want[ip] = true
+		}
+		for _, rec := range existing {
+			if want[rec.Content] {
+				delete(want, rec.Content)
+				continue
+			}
+			if err := cloudflareCall("DELETE", "/zones/"+zone+"/dns_records/"+rec.ID, nil, nil); err != nil {
+				return err
+			}
+		}
+		for _, ip := range ips {
+			if !want[ip] {
+				continue
+			}
+			rec := map[string]any{"type": typ, "name": name, "content": ip, "ttl": *dnsTTL, "proxied": false}
+			if err := cloudflareCall("POST", "/zones/"+zone+"/dns_records", rec, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dryRun 完成目标的展开、去重和抽样后只打印目标数量和前 -preview 个目标，不发送任何探测
+func dryRun() error {
+	if *sweep {
+		space := newRoutableSpace()
+		if *resume >= space.size {
+			return fmt.Errorf("起始序号 %d 超出可路由地址总数 %d", *resume, space.size)
+		}
+		perm := newPermutation(space.size, seededRand())
+		fmt.Printf("目标总数: %d\n", space.size-*resume)
+		for i := *resume; i < space.size && i-*resume < uint64(*preview); i++ {
+			fmt.Println(space.addr(perm.at(i)))
+		}
+		return nil
+	}
+
+	targets, _, err := loadTargets()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("目标总数: %d\n", len(targets))
+	for i, t := range targets {
+		if i >= *preview {
+			break
+		}
+		fmt.Println(strings.Join(append([]string{t.ip}, t.labels...), ","))
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// icmpSocket 为同一源地址上所有ICMP探测共享的原始套接字。每个探测使用各自的序号，
+// 由 -readers 个接收协程按标识符和序号把应答分发给等待中的探测
+type icmpSocket struct {
+	conn     net.PacketConn
+	proto    int
+	kernelTS bool
+	id       int
+	foreign  sync.Once // 首次收到其他进程请求的应答时警告
+
+	mu      sync.Mutex
+	seq     int
+	xseq    int
+	pending map[int]*echoWait   // 键为回显请求的序号，扩展回显请求为 extendedKeys 加序号
+	expired map[int]expiredEcho // 已超时的请求，在保留期内不重新分配其序号，以识别迟到的应答
+	drops   uint64              // 上次检查时内核的丢包计数
+}
+
+// expiredEcho 为一个已超时的回显请求，until 之前收到的对应应答计为迟到应答
+type expiredEcho struct {
+	peer  string
+	until time.Time
+}
+
+// expiredHold 为超时请求的保留期相对该次探测的超时时间的倍数
+const expiredHold = 10
+
+// lateReplies 按目标地址记录在超时之后才到达的应答数，这些应答不会交给之后发往同一目标的探测
+var lateReplies = struct {
+	sync.Mutex
+	m map[string]int
+}{m: make(map[string]int)}
+
+// echoWait 为一个已发出、尚未收到结果的回显请求
+type echoWait struct {
+	peer  string
+	reply chan echoReply
+}
+
+// echoReply 为接收协程交给探测的结果，err 不为空表示收到了针对该请求的差错消息
+type echoReply struct {
+	msg []byte
+	at  time.Time
+	err error
+}
+
+var icmpSockets = struct {
+	sync.Mutex
+	m map[string]*icmpSocket
+}{m: make(map[string]*icmpSocket)}
+
+// icmpSocketFor 返回 network 和源地址对应的共享套接字，首次使用时创建并启动接收协程
+func icmpSocketFor(network, src string) (*icmpSocket, error) {
+	icmpSockets.Lock()
+	defer icmpSockets.Unlock()
+
+	key := network + "|" + src
+	if s, ok := icmpSockets.m[key]; ok {
+		return s, nil
+	}
+
+	conn, err := listen(network, src)
+	if err != nil {
+		return nil, err
+	}
+	if err := setSocketBuffers(conn, *rcvbuf, *sndbuf); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	proto := 1
+	if network == "ip6:ipv6-icmp" {
+		proto = 58
+	}
+
+	s := &icmpSocket{
+		conn:     conn,
+		proto:    proto,
+		kernelTS: *kernelTime && enableKernelTimestamps(conn),
+		id:       icmpID(),
+		pending:  make(map[int]*echoWait),
+		expired:  make(map[int]expiredEcho),
+	}
+	for i := 0; i < max(*readers, 1); i++ {
+		go s.readLoop()
+	}
+	icmpSockets.m[key] = s
+	return s, nil
+}
+
+// extendedKeys 为扩展回显请求 (RFC 8335) 在 pending 中的键的起点，其序号只有8位，与普通回显请求分开分配
+const extendedKeys = 0x10000
+
+// peerKey 返回用于匹配应答的目标地址，链路本地地址带上区域，以区分不同接口上的相同地址
+func peerKey(ip net.IP, zone string) string {
+	if zone != "" && ip.IsLinkLocalUnicast() {
+		return ip.String() + "%" + zone
+	}
+	return ip.String()
+}
+
+// register 为发往 peer 的请求分配一个未被占用的序号，返回的键用于 unregister，
+// 普通回显请求的键即为序号，扩展回显请求的序号为键减去 extendedKeys。
+// 优先跳过仍在保留期内的超时请求的序号，序号全部被占用时才复用其中之一
+func (s *icmpSocket) register(peer string, extended bool) (int, *echoWait, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next, base, size := &s.seq, 0, 0x10000
+	if extended {
+		next, base, size = &s.xseq, extendedKeys, 0x100
+	}
+
+	now := time.Now()
+	key, fallback := -1, -1
+	for i := 0; i < size && key < 0; i++ {
+		*next = (*next + 1) % size
+		k := base + *next
+		if _, busy := s.pending[k]; busy {
+			continue
+		}
+		if e, ok := s.expired[k]; ok && now.Before(e.until) {
+			if fallback < 0 {
+				fallback = k
+			}
+			continue
+		}
+		key = k
+	}
+	if key < 0 {
+		key = fallback
+	}
+	if key < 0 {
+		return 0, nil, fmt.Errorf("等待应答的ICMP请求过多")
+	}
+
+	delete(s.expired, key)
+	w := &echoWait{peer: peer, reply: make(chan echoReply, 1)}
+	s.pending[key] = w
+	return key, w, nil
+}
+
+func (s *icmpSocket) unregister(key int) {
+	s.mu.Lock()
+	delete(s.pending, key)
+	s.mu.Unlock()
+}
+
+// expire 把超时的请求移出等待列表并保留其序号，保留期内收到的对应应答计为迟到应答。
+// timeout 为该次探测实际使用的超时时间，目标可以用 timeout= 单独指定
+func (s *icmpSocket) expire(key int, peer string, timeout time.Duration) {
+	s.mu.Lock()
+	delete(s.pending, key)
+	s.expired[key] = expiredEcho{peer: peer, until: time.Now().Add(expiredHold * timeout)}
+	s.mu.Unlock()
+}
+
+// readLoop 持续读取套接字，把属于本进程且目标匹配的应答或差错消息交给对应的探测
+func (s *icmpSocket) readLoop() {
+	buf := make([]byte, 1500)
+	for {
+		n, peer, at, err := readTimestamped(s.conn, buf, s.kernelTS)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			slog.Debug("读取ICMP套接字失败", "err", err)
+			continue
+		}
+
+		m, ok := matchEcho(s.proto, buf[:n])
+		if !ok || m.id != s.id {
+			continue
+		}
+		if !ownEcho(m) {
+			// 标识符相同但令牌不同，是同一台机器上其他进程的请求的应答
+			foreignReplyCount.Add(1)
+			s.foreign.Do(func() {
+				slog.Warn("收到其他进程的ICMP请求的应答，可能有其他实例或 ping 使用了相同的标识符，这些应答已被忽略", "id", s.id)
+			})
+			continue
+		}
+		// 差错消息可能来自路由器，链路本地目标的区域取自消息到达的接口
+		from := peer.(*net.IPAddr)
+		target := from.IP
+		if m.target != nil {
+			target = m.target
+		}
+		host := peerKey(target, from.Zone)
+
+		key := m.seq
+		if m.extended {
+			key += extendedKeys
+		}
+
+		s.mu.Lock()
+		w, ok := s.pending[key]
+		if ok && w.peer == host {
+			delete(s.pending, key)
+		} else {
+			ok = false
+		}
+		late := false
+		if e, expired := s.expired[key]; !ok && expired && e.peer == host {
+			delete(s.expired, key)
+			late = m.err == nil
+		}
+		s.mu.Unlock()
+
+		// 被选中跟踪的目标发来的未能交给探测的消息也记录下来，这类消息常是目标看似超时的原因
+		if !ok && traced(target.String()) {
+			traceProbe("收到未匹配的消息", host, at, "id", m.id, "seq", m.seq, "bytes", n, "late", late, "err", m.err)
+		}
+		if late {
+			lateReplyCount.Add(1)
+			lateReplies.Lock()
+			lateReplies.m[host]++
+			lateReplies.Unlock()
+			slog.Debug("收到迟到的应答", "ip", host, "seq", m.seq)
+		}
+
+		if ok {
+			w.reply <- echoReply{msg: append([]byte(nil), buf[:n]...), at: at, err: m.err}
+		}
+	}
+}
+
+// checkSocketDrops 检查各个共享套接字自上次检查以来内核丢弃的报文数，
+// 丢包会被误判为超时，因此发现丢包时提示增大接收缓冲区
+func checkSocketDrops() {
+	icmpSockets.Lock()
+	defer icmpSockets.Unlock()
+
+	for key, s := range icmpSockets.m {
+		drops, ok := socketDrops(s.conn)
+		if !ok {
+			continue
+		}
+		if drops > s.drops {
+			slog.Warn("内核因接收缓冲区已满丢弃了ICMP报文，部分目标可能被误判为超时，建议增大 -rcvbuf", "socket", key, "drops", drops-s.drops)
+		}
+		s.drops = drops
+	}
+}
+
+// lateCount 返回目标在本次运行中收到的迟到应答数
+func lateCount(ip string) int {
+	if addr, err := netip.ParseAddr(ip); err == nil {
+		ip = addr.String()
+	}
+	lateReplies.Lock()
+	defer lateReplies.Unlock()
+	return lateReplies.m[ip]
+}
+
+// reportLateReplies 在扫描结束时报告自上次报告以来收到的迟到应答总数
+func reportLateReplies(since int64) {
+	if n := lateReplyCount.Value() - since; n > 0 {
+		slog.Warn("部分应答在超时之后才到达，已单独计数而未计入延迟统计，可考虑增大 -timeout", "late", n)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// hostState 为 -events 在两次扫描之间保存的单个目标的状态，since 为进入该状态的扫描时间。
+// streak 为与当前状态相反的连续扫描次数，streakSince 为其中第一次扫描的时间
+type hostState struct {
+	Up          bool      `json:"up"`
+	Since       time.Time `json:"since"`
+	Streak      int       `json:"streak,omitempty"`
+	StreakSince time.Time `json:"streak_since"`
+}
+
+// hostEvent 为一次状态变化，time 为确认状态变化的扫描时间，since 为连续相反结果中第一次扫描的时间。
+// 恢复事件带有此前断开的时间和断开时长，maintenance 表示状态变化发生在目标的维护时段内，不应告警。
+// 上级目标同时无响应时断开事件记为 unreachable，parent 为该上级目标
+type hostEvent struct {
+	Time        time.Time  `json:"time"`
+	IP          string     `json:"ip"`
+	Event       string     `json:"event"`
+	Since       time.Time  `json:"since"`
+	DownSince   *time.Time `json:"down_since,omitempty"`
+	Downtime    float64    `json:"downtime_s,omitempty"`
+	Maintenance bool       `json:"maintenance,omitempty"`
+	Parent      string     `json:"parent,omitempty"`
+}
+
+// validateEvents 检查 -down-after 和 -up-after
+func validateEvents() error {
+	if *downAfter < 1 || *upAfter < 1 {
+		return fmt.Errorf("-down-after 和 -up-after 必须大于0")
+	}
+	return nil
+}
+
+// checkDependencies 检查输入中以 dep= 指定的上级目标是否也在目标之中，上级目标须一同探测才能判断其状态
+func checkDependencies(targets []target) error {
+	addrs := make(map[string]bool, len(targets))
+	for _, t := range targets {
+		addrs[traceKey(t.ip)] = true
+	}
+	for _, t := range targets {
+		if t.opts.dep != "" && !addrs[t.opts.dep] {
+			return fmt.Errorf("目标 %s 依赖的上级目标 %s 不在输入的目标中", t.ip, t.opts.dep)
+		}
+	}
+	return nil
+}
+
+// eventsStatePath 返回保存各目标上次状态的文件，与事件文件放在一起
+func eventsStatePath(filename string) string {
+	return filename + ".state"
+}
+
+// loadHostStates 读取上次扫描保存的状态，文件不存在时返回空的状态
+func loadHostStates(filename string) (map[string]hostState, error) {
+	states := make(map[string]hostState)
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("无法读取状态文件: %v", err)
+	}
+	if err := json.Unmarshal(data, &states); err != nil {
+		return nil, fmt.Errorf("无法解析状态文件 %s: %v", filename, err)
+	}
+	return states, nil
+}
+
+// writeEvents 把本次扫描与上次保存的状态比较，将目标的断开和恢复以每行一个JSON对象追加到 -events 文件，并保存新的状态。
+// 连续 -down-after 次扫描无响应才认为断开，连续 -up-after 次有响应才认为恢复，偶发的丢包不会产生事件。
+// 第一次出现的目标只记录其状态而不产生事件，疑似被限速的目标状态不确定，保持原来的状态。
+// 处于维护时段内的目标的事件照常写入，但标为维护中，也不输出告警日志。
+// 以 dep= 指定了上级目标的目标在上级目标本次也无响应时，断开记为因依赖不可达 (unreachable)，同样不输出告警日志
+func writeEvents(filename string, targets []target, results []result, limited []string, at time.Time, maint maintenanceSchedule) error {
+	statePath := eventsStatePath(filename)
+	states, err := loadHostStates(statePath)
+	if err != nil {
+		return err
+	}
+
+	alive := make(map[string]bool, len(results))
+	for _, res := range results {
+		alive[res.ip] = true
+	}
+	unknown := make(map[string]bool, len(limited))
+	for _, ip := range limited {
+		unknown[ip] = true
+	}
+	// 上级目标按规范化的地址查找
+	byAddr := make(map[string]string, len(targets))
+	for _, t := range targets {
+		byAddr[traceKey(t.ip)] = t.ip
+	}
+	parentDown := func(t target) bool {
+		parent, ok := byAddr[t.opts.dep]
+		return ok && !alive[parent] && !unknown[parent]
+	}
+
+	var events []hostEvent
+	for _, t := range targets {
+		if unknown[t.ip] {
+			continue
+		}
+		up := alive[t.ip]
+		prev, seen := states[t.ip]
+		if !seen {
+			states[t.ip] = hostState{Up: up, Since: at}
+			continue
+		}
+		if prev.Up == up {
+			if prev.Streak > 0 {
+				states[t.ip] = hostState{Up: up, Since: prev.Since}
+			}
+			continue
+		}
+
+		next := prev
+		next.Streak++
+		if next.Streak == 1 {
+			next.StreakSince = at
+		}
+		threshold := *downAfter
+		if up {
+			threshold = *upAfter
+		}
+		if next.Streak < threshold {
+			states[t.ip] = next
+			continue
+		}
+		since := next.StreakSince
+		states[t.ip] = hostState{Up: up, Since: since}
+		e := hostEvent{Time: at, IP: t.ip, Event: "down", Since: since, Maintenance: maint.covers(t)}
+		if up {
+			downSince := prev.Since
+			e.Event, e.DownSince, e.Downtime = "up", &downSince, since.Sub(downSince).Seconds()
+			slog.Info("目标已恢复", "ip", t.ip, "downtime", since.Sub(downSince).Round(time.Second), "maintenance", e.Maintenance)
+		} else if parentDown(t) {
+			e.Event, e.Parent = "unreachable", t.opts.dep
+			slog.Info("上级目标无响应，目标因依赖不可达", "ip", t.ip, "parent", t.opts.dep, "since", since)
+		} else if e.Maintenance {
+			slog.Info("维护期间目标已断开", "ip", t.ip, "since", since)
+		} else {
+			slog.Warn("目标已断开", "ip", t.ip, "since", since)
+		}
+		events = append(events, e)
+	}
+
+	if len(events) > 0 {
+		file, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return fmt.Errorf("无法打开事件文件: %v", err)
+		}
+		enc := json.NewEncoder(file)
+		for _, e := range events {
+			if err := enc.Encode(e); err != nil {
+				file.Close()
+				return fmt.Errorf("无法写入事件文件: %v", err)
+			}
+		}
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("无法写入事件文件: %v", err)
+		}
+	}
+
+	data, err := json.Marshal(states)
+	if err != nil {
+		return fmt.Errorf("无法编码状态: %v", err)
+	}
+	// 先写入临时文件再改名，中途退出时不会留下不完整的状态
+	tmp := statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("无法写入状态文件: %v", err)
+	}
+	if err := os.Rename(tmp, statePath); err != nil {
+		return fmt.Errorf("无法写入状态文件: %v", err)
+	}
+	return nil
+}
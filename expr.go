@@ -0,0 +1,312 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// expression 是编译后的表达式，变量和结果均为 float64，布尔值用 1 和 0 表示。
+// 支持 + - * /、比较运算、&& || ! 和括号，数字可带时间单位(换算为毫秒，如 80ms、1s)或百分号(如 95%)。
+// 除数为0时结果为正无穷，如 -score 中 latency/speed 在没有测速时排在最后，而不是得到无法排序的 NaN
+type expression struct {
+	src  string
+	eval func(env map[string]float64) float64
+	used map[string]bool // 表达式中引用的变量
+}
+
+// parseExpression 编译表达式，vars 为允许使用的变量名，出现其他标识符时报错
+func parseExpression(src string, vars []string) (*expression, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens, vars: vars, used: make(map[string]bool)}
+
+	fn, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("表达式中有多余的内容: %s", p.tokens[p.pos].text)
+	}
+	return &expression{src: src, eval: fn, used: p.used}, nil
+}
+
+// test 求值并按非0为真返回布尔结果
+func (e *expression) test(env map[string]float64) bool {
+	return e.eval(env) != 0
+}
+
+type tokenKind int
+
+const (
+	tokNumber tokenKind = iota
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value float64
+}
+
+// tokenize 把表达式拆分为数字、标识符和运算符
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	rs := []rune(src)
+	for i := 0; i < len(rs); {
+		c := rs[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c >= '0' && c <= '9' || c == '.':
+			j := i
+			for j < len(rs) && (rs[j] >= '0' && rs[j] <= '9' || rs[j] == '.') {
+				j++
+			}
+			k := j
+			for k < len(rs) && (unicode.IsLetter(rs[k]) || rs[k] == '%') {
+				k++
+			}
+			v, err := parseNumber(string(rs[i:j]), string(rs[j:k]))
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: string(rs[i:k]), value: v})
+			i = k
+
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) || rs[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: string(rs[i:j])})
+			i = j
+
+		default:
+			op := string(c)
+			if i+1 < len(rs) {
+				switch two := string(rs[i : i+2]); two {
+				case "&&", "||", "==", "!=", "<=", ">=":
+					op = two
+				}
+			}
+			if !strings.Contains("+-*/()<>!", op) && len(op) == 1 {
+				return nil, fmt.Errorf("表达式中有无法识别的字符: %s", op)
+			}
+			tokens = append(tokens, token{kind: tokOp, text: op})
+			i += len([]rune(op))
+		}
+	}
+	return tokens, nil
+}
+
+// parseNumber 解析带可选单位的数字，时间单位换算为毫秒
+func parseNumber(num, unit string) (float64, error) {
+	switch unit {
+	case "", "%":
+		v, err := strconv.ParseFloat(num, 64)
+		if err != nil {
+			return 0, fmt.Errorf("无效的数字: %s", num)
+		}
+		return v, nil
+	}
+	d, err := time.ParseDuration(num + unit)
+	if err != nil {
+		return 0, fmt.Errorf("无效的时间: %s%s", num, unit)
+	}
+	return float64(d) / float64(time.Millisecond), nil
+}
+
+type exprFunc = func(env map[string]float64) float64
+
+type exprParser struct {
+	tokens []token
+	pos    int
+	vars   []string
+	used   map[string]bool
+}
+
+func (p *exprParser) peekOp(ops ...string) string {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != tokOp {
+		return ""
+	}
+	for _, op := range ops {
+		if p.tokens[p.pos].text == op {
+			p.pos++
+			return op
+		}
+	}
+	return ""
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (p *exprParser) or() (exprFunc, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekOp("||") != "" {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(env map[string]float64) float64 { return boolValue(l(env) != 0 || right(env) != 0) }
+	}
+	return left, nil
+}
+
+func (p *exprParser) and() (exprFunc, error) {
+	left, err := p.compare()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekOp("&&") != "" {
+		right, err := p.compare()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(env map[string]float64) float64 { return boolValue(l(env) != 0 && right(env) != 0) }
+	}
+	return left, nil
+}
+
+func (p *exprParser) compare() (exprFunc, error) {
+	left, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	op := p.peekOp("<", "<=", ">", ">=", "==", "!=")
+	if op == "" {
+		return left, nil
+	}
+	right, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	cmp := map[string]func(a, b float64) bool{
+		"<":  func(a, b float64) bool { return a < b },
+		"<=": func(a, b float64) bool { return a <= b },
+		">":  func(a, b float64) bool { return a > b },
+		">=": func(a, b float64) bool { return a >= b },
+		"==": func(a, b float64) bool { return a == b },
+		"!=": func(a, b float64) bool { return a != b },
+	}[op]
+	return func(env map[string]float64) float64 { return boolValue(cmp(left(env), right(env))) }, nil
+}
+
+func (p *exprParser) sum() (exprFunc, error) {
+	left, err := p.product()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peekOp("+", "-")
+		if op == "" {
+			return left, nil
+		}
+		right, err := p.product()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		if op == "+" {
+			left = func(env map[string]float64) float64 { return l(env) + right(env) }
+		} else {
+			left = func(env map[string]float64) float64 { return l(env) - right(env) }
+		}
+	}
+}
+
+func (p *exprParser) product() (exprFunc, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peekOp("*", "/")
+		if op == "" {
+			return left, nil
+		}
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		if op == "*" {
+			left = func(env map[string]float64) float64 { return l(env) * right(env) }
+		} else {
+			left = func(env map[string]float64) float64 {
+				d := right(env)
+				if d == 0 {
+					return math.Inf(1)
+				}
+				return l(env) / d
+			}
+		}
+	}
+}
+
+func (p *exprParser) unary() (exprFunc, error) {
+	switch p.peekOp("!", "-") {
+	case "!":
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(env map[string]float64) float64 { return boolValue(x(env) == 0) }, nil
+	case "-":
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(env map[string]float64) float64 { return -x(env) }, nil
+	}
+	return p.primary()
+}
+
+func (p *exprParser) primary() (exprFunc, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("表达式不完整")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+
+	switch t.kind {
+	case tokNumber:
+		return func(map[string]float64) float64 { return t.value }, nil
+	case tokIdent:
+		if !slices.Contains(p.vars, t.text) {
+			return nil, fmt.Errorf("未知的变量: %s，可用的变量: %s", t.text, strings.Join(p.vars, ", "))
+		}
+		p.used[t.text] = true
+		return func(env map[string]float64) float64 { return env[t.text] }, nil
+	}
+
+	if t.text == "(" {
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peekOp(")") == "" {
+			return nil, fmt.Errorf("缺少右括号")
+		}
+		return x, nil
+	}
+	return nil, fmt.Errorf("表达式中有意外的运算符: %s", t.text)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseExpression(t *testing.T) {
+	vars := []string{"latency", "loss", "speed"}
+	env := map[string]float64{"latency": 80, "loss": 5, "speed": 0}
+	tests := []struct {
+		src  string
+		want float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3},
+		{"8 / 4 / 2", 1},
+		{"-2 * 3", -6},
+		{"1 + 1 < 3", 1},
+		{"latency < 100ms && loss <= 5%", 1},
+		{"latency > 1s || loss > 10", 0},
+		{"1 || 0 && 0", 1},
+		{"!loss", 0},
+		{"!(latency == 80)", 0},
+		{"latency != 80", 0},
+		{"0.5s", 500},
+		{"latency / speed", math.Inf(1)},
+		{"0 / 0", math.Inf(1)},
+		{"latency / speed > 1000", 1},
+	}
+	for _, tt := range tests {
+		e, err := parseExpression(tt.src, vars)
+		if err != nil {
+			t.Errorf("parseExpression(%q) error: %v", tt.src, err)
+			continue
+		}
+		if got := e.eval(env); got != tt.want {
+			t.Errorf("parseExpression(%q) = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	vars := []string{"latency", "loss"}
+	for _, src := range []string{
+		"jitter < 5",
+		"latency <",
+		"(latency < 5",
+		"latency < 5)",
+		"latency 5",
+		"latency # 5",
+		"1..2",
+		"5xs",
+		"* 2",
+		"",
+	} {
+		if _, err := parseExpression(src, vars); err == nil {
+			t.Errorf("parseExpression(%q) succeeded, want error", src)
+		}
+	}
+}
+
+func TestParseExpressionUsed(t *testing.T) {
+	e, err := parseExpression("latency < 100 && latency > 10", []string{"latency", "loss"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.used["latency"] || e.used["loss"] {
+		t.Errorf("used = %v, want only latency", e.used)
+	}
+}
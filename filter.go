@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// filterVars 为 -filter 表达式可用的变量: -score 的全部指标，另有 latency 为结果的延迟 (毫秒)
+var filterVars = append([]string{"latency"}, scoreVars...)
+
+// parseFilter 编译 -filter 表达式，未设置时返回 nil
+func parseFilter(src string) (*expression, error) {
+	if src == "" {
+		return nil, nil
+	}
+	e, err := parseExpression(src, filterVars)
+	if err != nil {
+		return nil, fmt.Errorf("无法解析 -filter 表达式: %v", err)
+	}
+	if e.used["speed"] && *speedURL == "" {
+		return nil, fmt.Errorf("过滤条件使用了下载速度，需要通过 -speed-url 测速")
+	}
+	return e, nil
+}
+
+// filterResults 返回满足过滤条件的结果，保持原有顺序
+func filterResults(results []result, e *expression) []result {
+	kept := make([]result, 0, len(results))
+	for _, res := range results {
+		if e.test(resultVars(res)) {
+			kept = append(kept, res)
+		}
+	}
+	slog.Info("已按条件过滤结果", "filter", e.src, "kept", len(kept), "removed", len(results)-len(kept))
+	return kept
+}
+
+// resultVars 返回 -filter 和 -sort 使用的单个结果的变量
+func resultVars(res result) map[string]float64 {
+	vars := hostVars(res)
+	vars["latency"] = float64(res.duration) / 1e6
+	return vars
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// maxFlows 为 -flows 的上限，各条流的校验和必须互不相同
+const maxFlows = 256
+
+// flowChecksumSum 返回第 flow 条流的回显请求各16位字 (不含校验和) 的反码和，同一条流的各次探测保持不变
+func flowChecksumSum(flow int) uint16 {
+	return uint16(0xa000 + flow)
+}
+
+// onesAdd 为16位反码加法
+func onesAdd(a, b uint16) uint16 {
+	s := uint32(a) + uint32(b)
+	return uint16(s&0xffff + s>>16)
+}
+
+// flowPayload 返回第 flow 条流的回显请求数据: 在令牌之后的两个字节填入补偿值，使不同的序号下
+// 整个ICMP消息的反码和都为 flowChecksumSum(flow)，从而校验和不变。IPv6 的校验和另含伪头部，对同一目标同样不变
+func flowPayload(v6 bool, id, seq, flow int) []byte {
+	data := echoPayload()
+	data[len(echoToken)], data[len(echoToken)+1] = 0, 0
+
+	msgType := byte(ipv4.ICMPTypeEcho)
+	if v6 {
+		msgType = byte(ipv6.ICMPTypeEchoRequest)
+	}
+	msg := append([]byte{msgType, 0, 0, 0, byte(id >> 8), byte(id), byte(seq >> 8), byte(seq)}, data...)
+	if len(msg)%2 == 1 {
+		msg = append(msg, 0)
+	}
+	var sum uint16
+	for i := 0; i < len(msg); i += 2 {
+		sum = onesAdd(sum, uint16(msg[i])<<8|uint16(msg[i+1]))
+	}
+	// 令牌长度为偶数，补偿值位于消息的偶数偏移处，恰好构成一个16位字
+	balance := onesAdd(flowChecksumSum(flow), ^sum)
+	data[len(echoToken)], data[len(echoToken)+1] = byte(balance>>8), byte(balance)
+	return data
+}
+
+// flowPing 发送属于第 flow 条流的回显请求。序号仍按共享套接字的规则分配，但校验和对同一条流保持不变
+// (Paris traceroute 的做法)，按ICMP头部前4个字节做ECMP哈希的路由器把同一条流的各次探测送上同一条路径，
+// 不同的流则可能被分到不同的路径
+func flowPing(ip, src string, timeout time.Duration, flow int) (time.Duration, []string, error) {
+	duration, _, err := exchangeEcho(ip, src, timeout, false, func(v6 bool, id, seq int) icmp.Message {
+		var msgType icmp.Type = ipv4.ICMPTypeEcho
+		if v6 {
+			msgType = ipv6.ICMPTypeEchoRequest
+		}
+		return icmp.Message{
+			Type: msgType,
+			Body: &icmp.Echo{ID: id, Seq: seq, Data: flowPayload(v6, id, seq, flow)},
+		}
+	})
+	return duration, nil, err
+}
+
+// flowColumns 返回 -flows 的附加列: 有响应的流数、各条流最低延迟中最高与最低之差，以及每条流的最低延迟。
+// 流间延迟差明显时目标很可能经由多条延迟不同的ECMP路径到达
+func flowColumns(best []time.Duration, ok []bool, overhead time.Duration) []string {
+	var lo, hi time.Duration
+	n := 0
+	var parts []string
+	for f, d := range best {
+		if !ok[f] {
+			continue
+		}
+		d = max(d-overhead, 0)
+		if n == 0 || d < lo {
+			lo = d
+		}
+		if n == 0 || d > hi {
+			hi = d
+		}
+		n++
+		parts = append(parts, strconv.Itoa(f)+":"+formatValue(d))
+	}
+	return []string{strconv.Itoa(n) + "/" + strconv.Itoa(len(best)), formatValue(hi - lo), strings.Join(parts, " ")}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// validateGroupBy 检查 -group-by 的分组键。provider 和 region 来自 -cloud 的标注，
+// 其余的键须为输入文件中的标签列，在读取目标后由 groupValue 检查
+func validateGroupBy() error {
+	switch *groupBy {
+	case "":
+		return nil
+	case "provider", "region":
+		if !*cloud {
+			return fmt.Errorf("-group-by %s 需要通过 -cloud 标注云服务商", *groupBy)
+		}
+	case "asn", "country":
+		return fmt.Errorf("-group-by %s 需要GeoIP/ASN数据，目前不支持，可使用 provider、region 或标签列", *groupBy)
+	}
+	if *sweep || *discoverAddr != "" {
+		return fmt.Errorf("-group-by 不支持 -sweep 和 -discover")
+	}
+	return nil
+}
+
+// groupValue 返回按 -group-by 取目标所属分组的函数。云服务商标注只依赖地址，无响应的目标也能归入分组
+func groupValue(labelColumns []string, clouds *cloudIndex) (func(t target) string, error) {
+	switch *groupBy {
+	case "provider":
+		return func(t target) string {
+			r, _ := clouds.lookup(t.ip)
+			return r.provider
+		}, nil
+	case "region":
+		return func(t target) string {
+			r, _ := clouds.lookup(t.ip)
+			return r.region
+		}, nil
+	}
+	i := slices.Index(labelColumns, *groupBy)
+	if i < 0 {
+		return nil, fmt.Errorf("未知的分组键: %s，可用 provider、region 或标签列", *groupBy)
+	}
+	return func(t target) string { return t.labels[i] }, nil
+}
+
+// group 为一个分组的汇总
+type group struct {
+	name      string
+	targets   int
+	latencies []time.Duration
+}
+
+// writeGroups 按 -group-by 把全部目标分组，写出每组的目标数、有响应数、存活率和中位延迟，按目标数降序排列
+func writeGroups(filename string, targets []target, results []result, labelColumns []string, clouds *cloudIndex) error {
+	value, err := groupValue(labelColumns, clouds)
+	if err != nil {
+		return err
+	}
+	alive := make(map[string]time.Duration, len(results))
+	for _, res := range results {
+		alive[res.ip] = res.duration
+	}
+
+	index := make(map[string]*group)
+	var groups []*group
+	for _, t := range targets {
+		name := value(t)
+		if name == "" {
+			name = "-"
+		}
+		g, ok := index[name]
+		if !ok {
+			g = &group{name: name}
+			index[name] = g
+			groups = append(groups, g)
+		}
+		g.targets++
+		if d, ok := alive[t.ip]; ok {
+			g.latencies = append(g.latencies, d)
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].targets > groups[j].targets
+	})
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("无法创建文件: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write(headerNames([]string{*groupBy, "目标数", "有响应", "存活率", unitColumn("中位延迟")}))
+	for _, g := range groups {
+		median := ""
+		if n := len(g.latencies); n > 0 {
+			slices.Sort(g.latencies)
+			median = formatValue(g.latencies[(n-1)/2])
+		}
+		rate := strconv.FormatFloat(float64(len(g.latencies))/float64(g.targets)*100, 'f', 1, 64) + "%"
+		writer.Write([]string{g.name, strconv.Itoa(g.targets), strconv.Itoa(len(g.latencies)), rate, median})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("写入CSV文件时出现错误: %v", err)
+	}
+
+	slog.Info("成功将分组统计写入文件", "file", filename, "group_by", *groupBy, "groups", len(groups))
+	return nil
+}
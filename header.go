@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// englishColumns 为 -headers en 时各列在输出文件中的英文名称，这些名称作为稳定的接口保持不变，
+// 带有 -unit 单位的列在英文名称后加上 _单位，如 jitter_ms。输入文件中的标签列不在其中，保持原样输出
+var englishColumns = map[string]string{
+	"IP地址":     "ip",
+	"网络延迟":     "latency",
+	"接口状态":     "interface_state",
+	"接口协议":     "interface_protocol",
+	"MAC地址":    "mac",
+	"QUIC版本":   "quic_version",
+	"应答码":      "rcode",
+	"层级":       "stratum",
+	"时钟偏差":     "clock_offset",
+	"去程延迟":     "forward_latency",
+	"回程延迟":     "return_latency",
+	"状态码":      "status_code",
+	"校验结果":     "check_result",
+	"记录路由":     "record_route",
+	"时间戳":      "timestamps",
+	"解析耗时":     "resolve_time",
+	"丢包率":      "loss",
+	"抖动":       "jitter",
+	"P50延迟":    "p50",
+	"P90延迟":    "p90",
+	"P99延迟":    "p99",
+	"源地址":      "source",
+	"数据中心":     "colo",
+	"迟到应答":     "late_replies",
+	"网络名称":     "network_name",
+	"滥用联系":     "abuse_contact",
+	"云服务商":     "provider",
+	"区域":       "region",
+	"下载速度":     "speed",
+	"得分":       "score",
+	"主机名":      "hostname",
+	"原始目标":     "origin",
+	"目标数":      "targets",
+	"有响应":      "alive",
+	"存活率":      "alive_rate",
+	"中位延迟":     "median_latency",
+	"有响应的观测点":  "reachable",
+	"最佳观测点":    "best_vantage",
+	"最佳延迟":     "best_latency",
+	"最差观测点":    "worst_vantage",
+	"最差延迟":     "worst_latency",
+	"有响应的流":    "flows",
+	"流间延迟差":    "flow_spread",
+	"各流最低延迟":   "flow_latencies",
+	"成功轮数":     "runs_ok",
+	"平均延迟":     "mean_latency",
+	"延迟标准差":    "stddev",
+	"延迟方差":     "variance",
+	"平均排名":     "mean_rank",
+	"排名变化":     "rank_change",
+	"发送":       "sent",
+	"接收":       "received",
+	"最小延迟":     "min_latency",
+	"最大延迟":     "max_latency",
+	"任播":       "anycast",
+	"各观测点数据中心": "colos",
+}
+
+// validateHeaders 检查 -headers
+func validateHeaders() error {
+	if *headerLang != "zh" && *headerLang != "en" {
+		return fmt.Errorf("未知的列名语言: %s，可用 zh 或 en", *headerLang)
+	}
+	return nil
+}
+
+// headerName 返回列在输出文件中的名称，-headers en 时换为英文名称
+func headerName(column string) string {
+	if *headerLang != "en" {
+		return column
+	}
+	suffix := ""
+	if base, ok := strings.CutSuffix(column, "("+*unit+")"); ok {
+		column, suffix = base, "_"+*unit
+	}
+	if name, ok := englishColumns[column]; ok {
+		return name + suffix
+	}
+	return column + suffix
+}
+
+// headerNames 对每一列调用 headerName
+func headerNames(columns []string) []string {
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = headerName(col)
+	}
+	return names
+}
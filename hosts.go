@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// expandHostnames 把主机名目标解析为其全部地址，每个地址作为一个继承了标签的目标，并记录解析出它的主机名。
+// 多个主机名解析到同一地址时只探测一次，无法解析的主机名被丢弃
+func expandHostnames(targets []target) []target {
+	addrs := make([][]net.IP, len(targets))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(*maxThreads, 1))
+	for i, t := range targets {
+		if isAddress(t.ip) {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			err := withNetns(*netns, func() error {
+				var err error
+				addrs[i], err = lookupHost(t.ip)
+				return err
+			})
+			if err != nil {
+				slog.Warn("无法解析主机名", "host", t.ip, "err", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var expanded []target
+	index := make(map[string]int)
+	add := func(t target) {
+		if i, ok := index[t.ip]; ok {
+			expanded[i].hosts = append(expanded[i].hosts, t.hosts...)
+			return
+		}
+		index[t.ip] = len(expanded)
+		expanded = append(expanded, t)
+	}
+	hostnames := 0
+	for i, t := range targets {
+		if isAddress(t.ip) {
+			add(t)
+			continue
+		}
+		hostnames++
+		for _, ip := range addrs[i] {
+			add(target{ip: ip.String(), labels: t.labels, hosts: []string{t.ip}, origin: t.origin})
+		}
+	}
+	if hostnames > 0 {
+		slog.Info("已解析主机名", "hosts", hostnames, "targets", len(expanded))
+	}
+	return expanded
+}
+
+// writeHostsFile 以 /etc/hosts 格式为每个主机名目标写入一行，把它映射到解析出的地址中延迟最低的有响应地址。
+// results 须已按延迟升序排列，没有任何地址响应的主机名被跳过
+func writeHostsFile(filename string, targets []target, results []result) error {
+	addrs := make(map[string]int)
+	hostsOf := make(map[string][]string)
+	var order []string
+	for _, t := range targets {
+		for _, host := range t.hosts {
+			if _, ok := addrs[host]; !ok {
+				order = append(order, host)
+			}
+			addrs[host]++
+		}
+		hostsOf[t.ip] = t.hosts
+	}
+
+	best := make(map[string]string)
+	for _, res := range results {
+		for _, host := range hostsOf[res.ip] {
+			if _, ok := best[host]; !ok {
+				best[host] = res.ip
+			}
+		}
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("无法创建文件: %v", err)
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	fmt.Fprintf(w, "# 由 icmp-scan 于 %s 生成\n", time.Now().Format(time.RFC3339))
+	for _, host := range order {
+		ip, ok := best[host]
+		if !ok {
+			slog.Warn("主机名没有有响应的地址", "host", host, "addrs", addrs[host])
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\n", ip, host)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("无法写入文件: %v", err)
+	}
+
+	slog.Info("成功将hosts条目写入文件", "file", filename, "hosts", len(best))
+	return nil
+}
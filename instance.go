@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+)
+
+// echoToken 为本进程随机生成的令牌，写在每个回显请求数据的开头。原始套接字会收到本机所有的ICMP报文，
+// 同一台机器上的其他实例或 ping 即使恰好使用了相同的标识符和序号，其应答也因令牌不同而被忽略
+var echoToken = func() []byte {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return b
+}()
+
+// icmpID 返回本进程回显请求使用的标识符: -icmp-id 指定的值，未指定时随机选择。
+// 不使用进程号，因为容器中的多个实例的进程号通常都是1
+var icmpID = sync.OnceValue(func() int {
+	if *icmpIdent > 0 {
+		return *icmpIdent
+	}
+	var b [2]byte
+	for {
+		rand.Read(b[:])
+		if id := int(binary.BigEndian.Uint16(b[:])); id != 0 {
+			return id
+		}
+	}
+})
+
+// echoPayload 返回回显请求的数据: 本进程的令牌加上固定的填充，共32字节，与 Windows ping 的数据长度相同
+func echoPayload() []byte {
+	return append(append([]byte(nil), echoToken...), "abcdefghijklmnopqrstuvwa"...)
+}
+
+// ownEcho 判断与本进程标识符一致的消息是否确实属于本进程的请求。回显应答必须原样带回令牌，扩展回显和时间戳应答不带数据；
+// 差错消息引用的原始请求可能只包含ICMP头部的前8个字节，此时无法区分，视为属于本进程
+func ownEcho(m echoMatch) bool {
+	if m.extended || m.timestamp {
+		return true
+	}
+	if m.err != nil && len(m.data) < len(echoToken) {
+		return true
+	}
+	return bytes.HasPrefix(m.data, echoToken)
+}
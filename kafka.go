@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaSink 将每个结果以IP为键写入Kafka主题，同一IP的结果总是落在同一分区
+type kafkaSink struct {
+	writer *kafka.Writer
+}
+
+// newKafkaSink 创建异步生产者，brokers 为逗号分隔的 host:port 列表
+func newKafkaSink(brokers, topic string) (*kafkaSink, error) {
+	var addrs []string
+	for _, b := range strings.Split(brokers, ",") {
+		if b = strings.TrimSpace(b); b != "" {
+			addrs = append(addrs, b)
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("没有指定Kafka服务器")
+	}
+	if topic == "" {
+		return nil, fmt.Errorf("没有指定Kafka主题")
+	}
+
+	w := &kafka.Writer{
+		Addr:         kafka.TCP(addrs...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		BatchTimeout: 100 * time.Millisecond,
+		Async:        true,
+		Completion: func(messages []kafka.Message, err error) {
+			if err != nil {
+				slog.Warn("写入Kafka失败", "messages", len(messages), "err", err)
+			}
+		},
+	}
+	return &kafkaSink{writer: w}, nil
+}
+
+func (k *kafkaSink) send(res result, columns []string) error {
+	return k.writer.WriteMessages(context.Background(), kafka.Message{
+		Key:   []byte(res.ip),
+		Value: resultJSON(res, columns),
+	})
+}
+
+// close 等待缓冲中的消息写出后关闭生产者
+func (k *kafkaSink) close() error {
+	return k.writer.Close()
+}
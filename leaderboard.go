@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// topResults 返回本次扫描到目前为止延迟最低的 n 个结果，尚未经过扫描结束后的重测、排序和补充列
+func (s *scanner) topResults(n int) []result {
+	s.mu.Lock()
+	results := append([]result(nil), s.collected...)
+	s.mu.Unlock()
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].duration < results[j].duration
+	})
+	return results[:min(n, len(results))]
+}
+
+// reportLeaderboard 按 interval 向stderr输出当前最快的 -leaderboard-n 个结果，直到 stop 被关闭。
+// 与上次输出相同时不再重复，扫描中途找到足够好的目标时可通过 -control 的 stop 命令提前结束
+func (s *scanner) reportLeaderboard(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last []string
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+		top := s.topResults(*leaderboardN)
+		if len(top) == 0 {
+			continue
+		}
+		lines := make([]string, len(top))
+		for i, res := range top {
+			lines[i] = fmt.Sprintf("%3d  %-39s %s", i+1, res.ip, formatLatency(res.duration))
+		}
+		if slices.Equal(lines, last) {
+			continue
+		}
+		last = lines
+		s.mu.Lock()
+		alive := len(s.collected)
+		s.mu.Unlock()
+		fmt.Fprintf(os.Stderr, "\n当前最快的 %d 个 (已完成: %d 总数: %d 有响应: %d)\n%s\n", len(top), s.done.Load(), s.total.Load(), alive, strings.Join(lines, "\n"))
+	}
+}
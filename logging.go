@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// setupLogging 按 -log-level 和 -log-format 配置输出到 stderr 的全局日志
+func setupLogging() error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		return fmt.Errorf("无效的日志级别: %s", *logLevel)
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch *logFormat {
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("未知的日志格式: %s", *logFormat)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
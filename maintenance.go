@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maintenanceWindow 为一个按 cron 表达式周期开始、持续 duration 的维护时段
+type maintenanceWindow struct {
+	name     string // 为空时适用于所有目标，否则只适用于输入中指定了 maintenance=name 的目标
+	fields   [5]cronField
+	duration time.Duration
+}
+
+// cronField 为 cron 表达式的一个字段允许的取值，restricted 表示字段不以 * 开头 (与 cron 相同，*/2 不算限定)
+type cronField struct {
+	allowed    map[int]bool
+	restricted bool
+}
+
+// cronRanges 为 分 时 日 月 周 各字段的取值范围，周的7与0同为周日
+var cronRanges = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+// maxMaintenance 为单个维护时段的最长持续时间
+const maxMaintenance = 7 * 24 * time.Hour
+
+// parseMaintenance 解析 -maintenance，多个时段以分号分隔，每个时段为 cron 表达式的5个字段加持续时间，
+// 如 "30 2 * * 0 2h"，前面加上 名称= 时只适用于输入中指定了该名称的目标
+func parseMaintenance(s string) ([]maintenanceWindow, error) {
+	var windows []maintenanceWindow
+	for _, spec := range strings.Split(s, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		var w maintenanceWindow
+		if name, rest, ok := strings.Cut(spec, "="); ok {
+			w.name, spec = strings.TrimSpace(name), rest
+		}
+		fields := strings.Fields(spec)
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("维护时段应为 cron 表达式的5个字段加持续时间: %s", spec)
+		}
+		for i := range w.fields {
+			f, err := parseCronField(fields[i], cronRanges[i][0], cronRanges[i][1])
+			if err != nil {
+				return nil, fmt.Errorf("无法解析维护时段 %s: %v", spec, err)
+			}
+			w.fields[i] = f
+		}
+		d, err := time.ParseDuration(fields[5])
+		if err != nil || d <= 0 || d > maxMaintenance {
+			return nil, fmt.Errorf("维护时段的持续时间须在0到 %s 之间: %s", maxMaintenance, fields[5])
+		}
+		w.duration = d
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// parseCronField 解析 cron 表达式的一个字段，支持 *、数字、a-b 范围、逗号分隔的列表和 /n 步长
+func parseCronField(s string, lo, hi int) (cronField, error) {
+	f := cronField{allowed: make(map[int]bool), restricted: !strings.HasPrefix(s, "*")}
+	for _, part := range strings.Split(s, ",") {
+		rng, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n < 1 {
+				return f, fmt.Errorf("无效的步长: %s", part)
+			}
+			step = n
+		}
+		from, to := lo, hi
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if from, err = strconv.Atoi(a); err != nil {
+				return f, fmt.Errorf("无效的取值: %s", part)
+			}
+			to = from
+			if isRange {
+				if to, err = strconv.Atoi(b); err != nil {
+					return f, fmt.Errorf("无效的取值: %s", part)
+				}
+			} else if hasStep {
+				to = hi
+			}
+		}
+		if from < lo || to > hi || from > to {
+			return f, fmt.Errorf("取值超出范围 %d-%d: %s", lo, hi, part)
+		}
+		for v := from; v <= to; v += step {
+			f.allowed[v] = true
+		}
+	}
+	return f, nil
+}
+
+// starts 判断维护时段是否在 t 所在的这一分钟开始。与 cron 相同，日和周都不以 * 开头时满足其一即可
+func (w maintenanceWindow) starts(t time.Time) bool {
+	weekday := int(t.Weekday())
+	dom, dow := w.fields[2].allowed[t.Day()], w.fields[4].allowed[weekday] || (weekday == 0 && w.fields[4].allowed[7])
+	day := dom && dow
+	if w.fields[2].restricted && w.fields[4].restricted {
+		day = dom || dow
+	}
+	return day && w.fields[0].allowed[t.Minute()] && w.fields[1].allowed[t.Hour()] && w.fields[3].allowed[int(t.Month())]
+}
+
+// active 判断 t 是否处于维护时段内，即此前 duration 内的某一分钟是时段的开始
+func (w maintenanceWindow) active(t time.Time) bool {
+	t = t.Truncate(time.Minute)
+	for start := t; t.Sub(start) < w.duration; start = start.Add(-time.Minute) {
+		if w.starts(start) {
+			return true
+		}
+	}
+	return false
+}
+
+// maintenanceSchedule 为 -maintenance 在某一时刻的状态，供 -events 判断各目标是否处于维护期间
+type maintenanceSchedule struct {
+	global bool            // 适用于所有目标的时段中是否有正在进行的
+	named  map[string]bool // 各名称的时段是否正在进行
+}
+
+// maintenanceAt 计算 t 时刻各维护时段是否正在进行，每次扫描只需计算一次
+func maintenanceAt(windows []maintenanceWindow, t time.Time) maintenanceSchedule {
+	m := maintenanceSchedule{named: make(map[string]bool)}
+	for _, w := range windows {
+		active := w.active(t)
+		if w.name == "" {
+			m.global = m.global || active
+		} else {
+			m.named[w.name] = m.named[w.name] || active
+		}
+	}
+	return m
+}
+
+// covers 判断目标是否处于维护期间
+func (m maintenanceSchedule) covers(t target) bool {
+	return m.global || m.named[t.opts.maintenance]
+}
+
+// checkMaintenanceNames 检查输入中目标指定的维护时段名称是否都在 -maintenance 中定义
+func checkMaintenanceNames(windows []maintenanceWindow, targets []target) error {
+	names := make(map[string]bool)
+	for _, w := range windows {
+		names[w.name] = true
+	}
+	for _, t := range targets {
+		if name := t.opts.maintenance; name != "" && !names[name] {
+			return fmt.Errorf("目标 %s 的维护时段 %s 未在 -maintenance 中定义", t.ip, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field      string
+		lo, hi     int
+		want       []int
+		restricted bool
+		wantErr    bool
+	}{
+		{field: "*", lo: 0, hi: 5, want: []int{0, 1, 2, 3, 4, 5}},
+		{field: "*/15", lo: 0, hi: 59, want: []int{0, 15, 30, 45}},
+		{field: "5", lo: 0, hi: 59, want: []int{5}, restricted: true},
+		{field: "1-5", lo: 1, hi: 31, want: []int{1, 2, 3, 4, 5}, restricted: true},
+		{field: "1-10/3", lo: 1, hi: 31, want: []int{1, 4, 7, 10}, restricted: true},
+		{field: "5/20", lo: 0, hi: 59, want: []int{5, 25, 45}, restricted: true},
+		{field: "1,3,5-6", lo: 0, hi: 7, want: []int{1, 3, 5, 6}, restricted: true},
+		{field: "0,7", lo: 0, hi: 7, want: []int{0, 7}, restricted: true},
+		{field: "59", lo: 0, hi: 59, want: []int{59}, restricted: true},
+		{field: "60", lo: 0, hi: 59, wantErr: true},
+		{field: "0", lo: 1, hi: 31, wantErr: true},
+		{field: "13", lo: 1, hi: 12, wantErr: true},
+		{field: "8", lo: 0, hi: 7, wantErr: true},
+		{field: "5-1", lo: 0, hi: 7, wantErr: true},
+		{field: "*/0", lo: 0, hi: 59, wantErr: true},
+		{field: "1-", lo: 0, hi: 59, wantErr: true},
+		{field: "a", lo: 0, hi: 59, wantErr: true},
+		{field: "", lo: 0, hi: 59, wantErr: true},
+	}
+	for _, tt := range tests {
+		f, err := parseCronField(tt.field, tt.lo, tt.hi)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseCronField(%q, %d, %d) succeeded, want error", tt.field, tt.lo, tt.hi)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseCronField(%q, %d, %d) error: %v", tt.field, tt.lo, tt.hi, err)
+			continue
+		}
+		var got []int
+		for v := range f.allowed {
+			got = append(got, v)
+		}
+		sort.Ints(got)
+		if !slices.Equal(got, tt.want) || f.restricted != tt.restricted {
+			t.Errorf("parseCronField(%q) = %v restricted=%v, want %v restricted=%v", tt.field, got, f.restricted, tt.want, tt.restricted)
+		}
+	}
+}
+
+func TestMaintenanceStarts(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.October, day, hour, minute, 0, 0, time.UTC)
+	}
+	// 2026-10-04 为周日，10-05 为周一
+	tests := []struct {
+		spec string
+		t    time.Time
+		want bool
+	}{
+		{"30 2 * * 0 1h", at(4, 2, 30), true},
+		{"30 2 * * 7 1h", at(4, 2, 30), true},
+		{"30 2 * * 7 1h", at(5, 2, 30), false},
+		{"30 2 * * 1-5 1h", at(5, 2, 30), true},
+		{"30 2 * * 1-5 1h", at(4, 2, 30), false},
+		{"30 2 * * 0 1h", at(4, 2, 31), false},
+		// 日和周都限定时满足其一即可
+		{"0 3 1 * 1 1h", at(1, 3, 0), true},
+		{"0 3 1 * 1 1h", at(5, 3, 0), true},
+		{"0 3 1 * 1 1h", at(6, 3, 0), false},
+		// 以 * 开头的日字段不算限定，须同时满足周
+		{"0 3 */2 * 1 1h", at(5, 3, 0), true},
+		{"0 3 */2 * 1 1h", at(12, 3, 0), false},
+		{"0 3 */2 * 1 1h", at(7, 3, 0), false},
+	}
+	for _, tt := range tests {
+		windows, err := parseMaintenance(tt.spec)
+		if err != nil {
+			t.Fatalf("parseMaintenance(%q) error: %v", tt.spec, err)
+		}
+		if got := windows[0].starts(tt.t); got != tt.want {
+			t.Errorf("%q starts(%s) = %v, want %v", tt.spec, tt.t.Format("Mon 01-02 15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestMaintenanceActive(t *testing.T) {
+	windows, err := parseMaintenance("30 2 * * 0 2h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := windows[0]
+	start := time.Date(2026, time.October, 4, 2, 30, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		offset time.Duration
+		want   bool
+	}{
+		{-time.Minute, false},
+		{0, true},
+		{119*time.Minute + 59*time.Second, true},
+		{2 * time.Hour, false},
+	} {
+		if got := w.active(start.Add(tt.offset)); got != tt.want {
+			t.Errorf("active(start%+v) = %v, want %v", tt.offset, got, tt.want)
+		}
+	}
+}
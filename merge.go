@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// vantageResults 为一个观测点的JSONL结果，按 -by 的值索引延迟和 -colo 记录的数据中心
+type vantageResults struct {
+	latencies map[string]time.Duration
+	colos     map[string]string
+}
+
+// mergedRow 为合并后的一个目标，latencies 和 colos 与观测点一一对应，ok 表示该观测点有响应
+type mergedRow struct {
+	key       string
+	latencies []time.Duration
+	colos     []string
+	ok        []bool
+	reachable int
+	best      int // 延迟最低的观测点，没有观测点有响应时为 -1
+	worst     int
+	anycast   string
+}
+
+// latencyUnitScale 为JSON结果中 latency_<单位> 键的单位
+var latencyUnitScale = map[string]time.Duration{
+	"latency_us": time.Microsecond,
+	"latency_ms": time.Millisecond,
+	"latency_s":  time.Second,
+}
+
+// readVantage 读取一个观测点的JSONL结果，跳过 -metadata 写入的元数据行。延迟按各文件自己的单位换算，
+// 不同 -unit 写出的文件可以一同合并
+func readVantage(filename, by string) (*vantageResults, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("无法打开文件: %v", err)
+	}
+	defer file.Close()
+
+	v := &vantageResults{latencies: make(map[string]time.Duration), colos: make(map[string]string)}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%s 第 %d 行不是有效的JSON: %v", filename, lineNo, err)
+		}
+		if _, ok := record["metadata"]; ok {
+			continue
+		}
+		key, ok := record[by]
+		if !ok {
+			return nil, fmt.Errorf("%s 第 %d 行没有 %s 字段", filename, lineNo, by)
+		}
+		var latency time.Duration
+		found := false
+		for name, scale := range latencyUnitScale {
+			if value, ok := record[name].(float64); ok {
+				latency, found = time.Duration(value*float64(scale)), true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%s 第 %d 行没有延迟字段", filename, lineNo)
+		}
+		// 同一个键出现多次时 (如 -by 为标签列) 取其中最低的延迟
+		k := fmt.Sprint(key)
+		if prev, ok := v.latencies[k]; !ok || latency < prev {
+			v.latencies[k] = latency
+		}
+		// 数据中心列的键随 -headers 而不同
+		for _, name := range []string{"数据中心", englishColumns["数据中心"]} {
+			if c, ok := record[name].(string); ok && c != "" {
+				v.colos[k] = c
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取 %s 失败: %v", filename, err)
+	}
+	return v, nil
+}
+
+// vantageNames 以去掉扩展名的文件名作为观测点的名称，重名时加上序号
+func vantageNames(files []string) []string {
+	names := make([]string, len(files))
+	seen := make(map[string]int)
+	for i, f := range files {
+		name := strings.TrimSuffix(filepath.Base(f), filepath.Ext(f))
+		seen[name]++
+		if seen[name] > 1 {
+			name += "_" + strconv.Itoa(seen[name])
+		}
+		names[i] = name
+	}
+	return names
+}
+
+// anycastVerdict 判断目标是否为任播地址: 各观测点记录的数据中心不同时为 "是"，相同时为 "否"；
+// 没有数据中心时，若全部观测点 (至少两个) 的延迟都低于 anycastRTT 则为 "疑似"，因为单个站点不可能同时
+// 离相距很远的各观测点都很近。anycastRTT 为 0 或无法判断时为空
+func anycastVerdict(row mergedRow, anycastRTT time.Duration) string {
+	seen := ""
+	sites := 0
+	for i, c := range row.colos {
+		if !row.ok[i] || c == "" {
+			continue
+		}
+		if seen != "" && c != seen {
+			return "是"
+		}
+		seen = c
+		sites++
+	}
+	if sites >= 2 {
+		return "否"
+	}
+	if anycastRTT <= 0 || len(row.ok) < 2 || row.reachable < len(row.ok) {
+		return ""
+	}
+	if row.latencies[row.worst] < anycastRTT {
+		return "疑似"
+	}
+	return ""
+}
+
+// mergeVantages 把各观测点的结果按键合并，有响应的观测点多的目标在前，其次按最低延迟升序
+func mergeVantages(vantages []*vantageResults, anycastRTT time.Duration) []mergedRow {
+	keys := make(map[string]bool)
+	for _, v := range vantages {
+		for k := range v.latencies {
+			keys[k] = true
+		}
+	}
+
+	rows := make([]mergedRow, 0, len(keys))
+	for k := range keys {
+		row := mergedRow{key: k, latencies: make([]time.Duration, len(vantages)), colos: make([]string, len(vantages)), ok: make([]bool, len(vantages)), best: -1, worst: -1}
+		for i, v := range vantages {
+			d, ok := v.latencies[k]
+			if !ok {
+				continue
+			}
+			row.latencies[i], row.colos[i], row.ok[i] = d, v.colos[k], true
+			row.reachable++
+			if row.best < 0 || d < row.latencies[row.best] {
+				row.best = i
+			}
+			if row.worst < 0 || d > row.latencies[row.worst] {
+				row.worst = i
+			}
+		}
+		row.anycast = anycastVerdict(row, anycastRTT)
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.reachable != b.reachable {
+			return a.reachable > b.reachable
+		}
+		if da, db := a.latencies[a.best], b.latencies[b.best]; da != db {
+			return da < db
+		}
+		return a.key < b.key
+	})
+	return rows
+}
+
+// writeMerged 写出合并后的表格: 键、各观测点的延迟 (无响应时为空)、有响应的观测点数、最佳和最差的观测点和延迟，
+// 以及任播的判断。输入中有数据中心时还写出各观测点看到的数据中心，如 tokyo:NRT berlin:FRA
+func writeMerged(filename, by string, names []string, rows []mergedRow) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("无法创建文件: %v", err)
+	}
+	defer file.Close()
+
+	header := []string{by}
+	for _, name := range names {
+		header = append(header, headerName(unitColumn(name)))
+	}
+	header = append(header, headerNames([]string{"有响应的观测点", "最佳观测点", unitColumn("最佳延迟"), "最差观测点", unitColumn("最差延迟"), "任播"})...)
+	hasColo := false
+	for _, r := range rows {
+		hasColo = hasColo || slices.ContainsFunc(r.colos, func(c string) bool { return c != "" })
+	}
+	if hasColo {
+		header = append(header, headerName("各观测点数据中心"))
+	}
+
+	writer := csv.NewWriter(file)
+	writer.Write(header)
+	for _, r := range rows {
+		record := []string{r.key}
+		for i := range names {
+			value := ""
+			if r.ok[i] {
+				value = formatValue(r.latencies[i])
+			}
+			record = append(record, value)
+		}
+		record = append(record, strconv.Itoa(r.reachable)+"/"+strconv.Itoa(len(names)))
+		if r.best >= 0 {
+			record = append(record, names[r.best], formatValue(r.latencies[r.best]), names[r.worst], formatValue(r.latencies[r.worst]))
+		} else {
+			record = append(record, "", "", "", "")
+		}
+		record = append(record, r.anycast)
+		if hasColo {
+			var sites []string
+			for i, c := range r.colos {
+				if c != "" {
+					sites = append(sites, names[i]+":"+c)
+				}
+			}
+			record = append(record, strings.Join(sites, " "))
+		}
+		writer.Write(record)
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("写入CSV文件时出现错误: %v", err)
+	}
+	return nil
+}
+
+// runMerge 实现 merge 子命令: 把在多个观测点扫描得到的JSONL结果按 -by 合并为一张表，
+// 每个观测点一列延迟，并汇总有响应的观测点数和最佳、最差的观测点，便于比较各地区的可达性
+func runMerge(args []string) {
+	if f := flag.Lookup("outfile"); f != nil {
+		f.DefValue = "merged.csv"
+		f.Value.Set(f.DefValue)
+	}
+	by := flag.String("by", "ip", "合并结果所依据的JSON键，如 ip 或 -resolve-all 写入的主机名列")
+	anycastRTT := flag.Duration("anycast-rtt", 0, "没有数据中心列时，全部观测点的延迟都低于该值的目标标为疑似任播，观测点须相距足够远，0 为不判断")
+
+	// 结果文件可以写在参数之前，如 merge a.jsonl b.jsonl -by ip
+	var files []string
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		files, args = append(files, args[0]), args[1:]
+	}
+	flag.CommandLine.Parse(args)
+	files = append(files, flag.Args()...)
+
+	if err := setupLogging(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	if _, ok := latencyUnits[*unit]; !ok {
+		slog.Error("未知的延迟单位", "unit", *unit)
+		return
+	}
+	if err := validateHeaders(); err != nil {
+		slog.Error(err.Error())
+		return
+	}
+	if *anycastRTT < 0 {
+		slog.Error("-anycast-rtt 不能小于0")
+		return
+	}
+	if len(files) < 2 {
+		slog.Error("请指定至少两个观测点的JSONL结果文件")
+		return
+	}
+
+	vantages := make([]*vantageResults, len(files))
+	for i, f := range files {
+		v, err := readVantage(f, *by)
+		if err != nil {
+			slog.Error(err.Error())
+			return
+		}
+		vantages[i] = v
+	}
+	names := vantageNames(files)
+
+	rows := mergeVantages(vantages, *anycastRTT)
+	if err := writeMerged(*outFile, *by, names, rows); err != nil {
+		slog.Error(err.Error())
+		return
+	}
+	slog.Info("成功将合并结果写入文件", "file", *outFile, "vantages", len(files), "targets", len(rows))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/subtle"
+	"expvar"
+	"log/slog"
+	"net"
+	"net/http"
+	_ "net/http/pprof"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+// 运行时计数器，通过 -pprof 地址下的 /debug/vars 以JSON形式提供
+var (
+	probesInFlight    = expvar.NewInt("probes_in_flight")
+	probesDone        = expvar.NewInt("probes_done")
+	probesOK          = expvar.NewInt("probes_ok")
+	lateReplyCount    = expvar.NewInt("late_replies")
+	foreignReplyCount = expvar.NewInt("foreign_replies")
+
+	// resultQueue 为当前扫描中等待汇总的结果通道，没有扫描进行时为空
+	resultQueue atomic.Pointer[chan result]
+)
+
+func init() {
+	expvar.Publish("goroutines", expvar.Func(func() any {
+		return runtime.NumGoroutine()
+	}))
+	expvar.Publish("result_queue", expvar.Func(func() any {
+		if ch := resultQueue.Load(); ch != nil {
+			return len(*ch)
+		}
+		return 0
+	}))
+	expvar.Publish("icmp_pending", expvar.Func(func() any {
+		icmpSockets.Lock()
+		defer icmpSockets.Unlock()
+		n := 0
+		for _, s := range icmpSockets.m {
+			s.mu.Lock()
+			n += len(s.pending)
+			s.mu.Unlock()
+		}
+		return n
+	}))
+	expvar.Publish("gc", expvar.Func(func() any {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		return map[string]any{
+			"num_gc":         m.NumGC,
+			"pause_total_ns": m.PauseTotalNs,
+			"heap_alloc":     m.HeapAlloc,
+			"heap_objects":   m.HeapObjects,
+		}
+	}))
+}
+
+// requireToken 只放行带有 Authorization: Bearer token 头部的请求
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// startPprof 在 -pprof 指定的地址上提供 net/http/pprof 和 /debug/vars。设置了 -pprof-token 时要求令牌，
+// 设置了 -pprof-cert 和 -pprof-key 时使用HTTPS，以便在本机之外安全地访问
+func startPprof() {
+	if *pprofAddr == "" {
+		return
+	}
+	if (*pprofCert == "") != (*pprofKey == "") {
+		slog.Error("-pprof-cert 和 -pprof-key 须同时指定")
+		return
+	}
+	token := *pprofToken
+	if token == "" {
+		token = os.Getenv("ICMP_SCAN_PPROF_TOKEN")
+	}
+	var handler http.Handler = http.DefaultServeMux
+	if token != "" {
+		handler = requireToken(token, handler)
+		if *pprofCert == "" {
+			slog.Warn("-pprof 服务未启用HTTPS，令牌以明文传输")
+		}
+	} else if host, _, err := net.SplitHostPort(*pprofAddr); err == nil {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			slog.Warn("-pprof 服务监听在本机之外且未设置 -pprof-token，任何人都可以访问", "addr", *pprofAddr)
+		}
+	}
+
+	go func() {
+		slog.Info("性能分析服务已启动", "addr", *pprofAddr, "pprof", "/debug/pprof/", "vars", "/debug/vars", "tls", *pprofCert != "", "auth", token != "")
+		var err error
+		if *pprofCert != "" {
+			err = http.ListenAndServeTLS(*pprofAddr, *pprofCert, *pprofKey, handler)
+		} else {
+			err = http.ListenAndServe(*pprofAddr, handler)
+		}
+		if err != nil {
+			slog.Error("性能分析服务启动失败", "err", err)
+		}
+	}()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// withNetns 在指定的网络命名空间中执行 fn，name 可以是 /var/run/netns 下的名称或完整路径
+func withNetns(name string, fn func() error) error {
+	if name == "" {
+		return fn()
+	}
+
+	path := name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join("/var/run/netns", name)
+	}
+
+	target, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("无法打开网络命名空间 %s: %v", name, err)
+	}
+	defer target.Close()
+
+	// 切换命名空间只对当前线程生效，需要在整个过程中锁定线程
+	runtime.LockOSThread()
+	orig, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()))
+	if err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("无法获取当前网络命名空间: %v", err)
+	}
+	defer orig.Close()
+
+	if err := unix.Setns(int(target.Fd()), unix.CLONE_NEWNET); err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("无法切换到网络命名空间 %s: %v", name, err)
+	}
+	defer func() {
+		// 恢复失败时保持线程锁定，goroutine 退出后该线程会被销毁而不会被复用
+		if unix.Setns(int(orig.Fd()), unix.CLONE_NEWNET) == nil {
+			runtime.UnlockOSThread()
+		}
+	}()
+
+	return fn()
+}
+
+// socketControl 在套接字绑定前设置选项，目前用于绑定VRF设备
+func socketControl(network, address string, c syscall.RawConn) error {
+	if *vrf == "" {
+		return nil
+	}
+
+	var serr error
+	err := c.Control(func(fd uintptr) {
+		serr = unix.SetsockoptString(int(fd), unix.SOL_SOCKET, unix.SO_BINDTODEVICE, *vrf)
+	})
+	if err != nil {
+		return err
+	}
+	if serr != nil {
+		return fmt.Errorf("无法绑定到设备 %s: %v", *vrf, serr)
+	}
+	return nil
+}
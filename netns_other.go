@@ -0,0 +1,22 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+func withNetns(name string, fn func() error) error {
+	if name == "" {
+		return fn()
+	}
+	return fmt.Errorf("当前系统不支持网络命名空间")
+}
+
+func socketControl(network, address string, c syscall.RawConn) error {
+	if *vrf != "" {
+		return fmt.Errorf("当前系统不支持绑定VRF设备")
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// sortKey 为 -sort 中的一个排序键，desc 表示降序
+type sortKey struct {
+	name string
+	desc bool
+}
+
+// parseSort 解析 -sort 的排序键列表，如 loss,latency 或 speed:desc,latency:asc，未设置时返回 nil。
+// 键名与 -filter 的变量相同，默认升序
+func parseSort(spec string) ([]sortKey, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	var keys []sortKey
+	for _, part := range strings.Split(spec, ",") {
+		name, dir, _ := strings.Cut(strings.TrimSpace(part), ":")
+		if !slices.Contains(filterVars, name) {
+			return nil, fmt.Errorf("未知的排序键: %s，可用的键: %s", name, strings.Join(filterVars, ", "))
+		}
+		key := sortKey{name: name}
+		switch dir {
+		case "", "asc":
+		case "desc":
+			key.desc = true
+		default:
+			return nil, fmt.Errorf("无效的排序方向: %s，应为 asc 或 desc", dir)
+		}
+		if name == "speed" && *speedURL == "" {
+			return nil, fmt.Errorf("按下载速度排序需要通过 -speed-url 测速")
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// sortResults 按排序键依次比较并重新排列结果，所有键都相同时保持原有顺序
+func sortResults(results []result, keys []sortKey) {
+	vars := make([]map[string]float64, len(results))
+	for i, res := range results {
+		vars[i] = resultVars(res)
+	}
+	order := make([]int, len(results))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := vars[order[i]], vars[order[j]]
+		for _, key := range keys {
+			if a[key.name] == b[key.name] {
+				continue
+			}
+			return (a[key.name] < b[key.name]) != key.desc
+		}
+		return false
+	})
+	sorted := make([]result, len(results))
+	for i, k := range order {
+		sorted[i] = results[k]
+	}
+	copy(results, sorted)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// writeCSV 将扫描结果写入CSV文件，columns 为 IP 和延迟之后的附加列，延迟以 -unit 为单位写为数字。
+// 设置了 -metadata 时表头前为以 # 开头的元数据注释行
+func writeCSV(filename string, results []result, columns []string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("无法创建文件: %v", err)
+	}
+	defer file.Close()
+
+	if runMeta != nil {
+		file.WriteString(runMeta.csvComment())
+	}
+	writer := csv.NewWriter(file)
+	writer.Write(headerNames(append([]string{"IP地址", unitColumn("网络延迟")}, columns...)))
+	for _, res := range results {
+		writer.Write(append([]string{res.ip, formatValue(res.duration)}, res.extra...))
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("写入CSV文件时出现错误: %v", err)
+	}
+
+	return nil
+}
+
+// parseSplit 解析 -split-by 的 prefix:/16 或 prefix:/16,/48 形式，分别为IPv4和IPv6的聚合前缀长度
+func parseSplit(spec string) (v4, v6 int, err error) {
+	rest, ok := strings.CutPrefix(spec, "prefix:")
+	if !ok {
+		return 0, 0, fmt.Errorf("不支持的拆分方式: %s", spec)
+	}
+
+	v4, v6 = -1, 48
+	for i, part := range strings.Split(rest, ",") {
+		bits, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(part), "/"))
+		if err != nil {
+			return 0, 0, fmt.Errorf("无效的前缀长度: %s", part)
+		}
+		switch i {
+		case 0:
+			v4 = bits
+		case 1:
+			v6 = bits
+		}
+	}
+	if v4 < 0 || v4 > 32 || v6 < 0 || v6 > 128 {
+		return 0, 0, fmt.Errorf("前缀长度超出范围: %s", spec)
+	}
+	return v4, v6, nil
+}
+
+// writeSplit 按聚合前缀把结果拆分写入多个CSV文件，文件名在 filename 的基础上附加前缀，
+// 如 ip.csv 拆分为 ip_10.0.0.0_16.csv，无法解析为IP的目标写入 ip_other.csv
+func writeSplit(filename string, results []result, columns []string, spec string) ([]string, error) {
+	v4, v6, err := parseSplit(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string][]result)
+	var order []string
+	for _, res := range results {
+		key := "other"
+		if addr, err := netip.ParseAddr(res.ip); err == nil {
+			bits := v4
+			if addr.Is6() && !addr.Is4In6() {
+				bits = v6
+			}
+			prefix, _ := addr.Unmap().WithZone("").Prefix(bits)
+			key = strings.ReplaceAll(prefix.Addr().String(), ":", "-") + "_" + strconv.Itoa(bits)
+		}
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], res)
+	}
+
+	ext := filepath.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+
+	var files []string
+	for _, key := range order {
+		name := base + "_" + key + ext
+		if err := writeCSV(name, groups[key], columns); err != nil {
+			return files, err
+		}
+		files = append(files, name)
+	}
+	return files, nil
+}
+
+// writeResults 将结果写入所有 -out 目标，未指定 -out 时按 -split-by 拆分或直接写入 -outfile，返回写入的文件
+func writeResults(results []result, columns []string, startTime time.Time) ([]string, error) {
+	if len(outputs) > 0 {
+		if err := writeOutputs(outputs, results, columns); err != nil {
+			return nil, err
+		}
+		slog.Info("全部输出写入完成", "outputs", len(outputs), "elapsed", time.Since(startTime).Round(time.Second))
+		var files []string
+		for _, out := range outputs {
+			files = append(files, out.path)
+		}
+		return files, nil
+	}
+
+	if *splitBy != "" {
+		files, err := writeSplit(*outFile, results, columns, *splitBy)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("成功将结果按前缀拆分写入文件", "files", len(files), "elapsed", time.Since(startTime).Round(time.Second))
+		return files, nil
+	}
+
+	if err := writeCSV(*outFile, results, columns); err != nil {
+		return nil, err
+	}
+	slog.Info("成功将结果写入文件", "file", *outFile, "results", len(results), "elapsed", time.Since(startTime).Round(time.Second))
+	return []string{*outFile}, nil
+}
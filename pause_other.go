@@ -0,0 +1,6 @@
+//go:build !unix
+
+package main
+
+// watchPauseSignals 在没有 SIGUSR1/SIGUSR2 的系统上不做任何事，可通过 -control 暂停和恢复
+func watchPauseSignals(s *scanner) {}
@@ -0,0 +1,21 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchPauseSignals 收到 SIGUSR1 时暂停发起新的探测，收到 SIGUSR2 时恢复，
+// 已完成的进度和结果都保留在内存中
+func watchPauseSignals(s *scanner) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for v := range sig {
+			s.setPaused(v == syscall.SIGUSR1)
+		}
+	}()
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// pcap 文件使用纳秒精度的时间戳，链路类型为不带链路层头部的原始IP报文
+const (
+	pcapMagicNanos = 0xa1b23c4d
+	linkTypeRaw    = 101
+	pcapSnapLen    = 65535
+)
+
+// capture 为 -pcap 指定的抓包文件，未设置时为 nil
+var capture *pcapWriter
+
+// pcapWriter 将探测收发的ICMP报文写入pcap文件。原始套接字收发的只有ICMP部分，
+// 写入时按收发双方的地址补上IPv4或IPv6头部，以便用 Wireshark 直接分析
+type pcapWriter struct {
+	mu   sync.Mutex
+	file *os.File
+	w    *bufio.Writer
+}
+
+func newPcapWriter(filename string) (*pcapWriter, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("无法创建抓包文件: %v", err)
+	}
+
+	hdr := make([]byte, 24)
+	binary.LittleEndian.PutUint32(hdr[0:], pcapMagicNanos)
+	binary.LittleEndian.PutUint16(hdr[4:], 2)
+	binary.LittleEndian.PutUint16(hdr[6:], 4)
+	binary.LittleEndian.PutUint32(hdr[16:], pcapSnapLen)
+	binary.LittleEndian.PutUint32(hdr[20:], linkTypeRaw)
+
+	w := bufio.NewWriter(file)
+	if _, err := w.Write(hdr); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("无法写入抓包文件: %v", err)
+	}
+	return &pcapWriter{file: file, w: w}, nil
+}
+
+// writeICMP 记录一个从 src 发往 dst 的ICMP或ICMPv6报文
+func (p *pcapWriter) writeICMP(ts time.Time, src, dst net.IP, msg []byte) {
+	var packet []byte
+	if src4, dst4 := src.To4(), dst.To4(); src4 != nil && dst4 != nil {
+		packet = make([]byte, 20+len(msg))
+		packet[0] = 0x45
+		binary.BigEndian.PutUint16(packet[2:], uint16(len(packet)))
+		packet[8] = 64
+		packet[9] = 1
+		copy(packet[12:], src4)
+		copy(packet[16:], dst4)
+		binary.BigEndian.PutUint16(packet[10:], checksum(packet[:20]))
+		copy(packet[20:], msg)
+	} else {
+		packet = make([]byte, 40+len(msg))
+		packet[0] = 0x60
+		binary.BigEndian.PutUint16(packet[4:], uint16(len(msg)))
+		packet[6] = 58
+		packet[7] = 64
+		copy(packet[8:], src.To16())
+		copy(packet[24:], dst.To16())
+		copy(packet[40:], msg)
+
+		// 内核负责计算ICMPv6校验和，发出的报文中该字段为0，这里按伪头部补上
+		body := packet[40:]
+		if len(body) >= 4 {
+			body[2], body[3] = 0, 0
+			pseudo := make([]byte, 40+len(body))
+			copy(pseudo, packet[8:40])
+			binary.BigEndian.PutUint32(pseudo[32:], uint32(len(body)))
+			pseudo[39] = 58
+			copy(pseudo[40:], body)
+			binary.BigEndian.PutUint16(body[2:], checksum(pseudo))
+		}
+	}
+
+	rec := make([]byte, 16)
+	binary.LittleEndian.PutUint32(rec[0:], uint32(ts.Unix()))
+	binary.LittleEndian.PutUint32(rec[4:], uint32(ts.Nanosecond()))
+	binary.LittleEndian.PutUint32(rec[8:], uint32(len(packet)))
+	binary.LittleEndian.PutUint32(rec[12:], uint32(len(packet)))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.w.Write(rec)
+	p.w.Write(packet)
+}
+
+func (p *pcapWriter) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.w.Flush(); err != nil {
+		p.file.Close()
+		return fmt.Errorf("无法写入抓包文件: %v", err)
+	}
+	return p.file.Close()
+}
+
+// checksum 计算互联网校验和
+func checksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
+
+// routeSource 返回发往 dst 时系统选择的源地址，src 已指定时直接使用
+func routeSource(dst net.IP, src string) net.IP {
+	if ip := net.ParseIP(src); ip != nil && !ip.IsUnspecified() {
+		return ip
+	}
+	var local net.IP
+	withNetns(*netns, func() error {
+		// UDP 的 connect 只查路由表，不会发送报文
+		conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: dst, Port: 9})
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		local = conn.LocalAddr().(*net.UDPAddr).IP
+		return nil
+	})
+	if local == nil {
+		if dst.To4() != nil {
+			return net.IPv4zero
+		}
+		return net.IPv6unspecified
+	}
+	return local
+}
+
+// capturedPacket 为从抓包文件中解析出的一个ICMP或ICMPv6报文
+type capturedPacket struct {
+	ts       time.Time
+	src, dst net.IP
+	proto    int // 1 为ICMP，58 为ICMPv6
+	msg      []byte
+}
+
+// readPcap 读取pcap文件中的ICMP报文，支持原始IP、以太网和Linux cooked链路类型，
+// 以及微秒和纳秒两种时间戳精度。分片报文和其他协议的报文会被忽略
+func readPcap(filename string) ([]capturedPacket, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取抓包文件: %v", err)
+	}
+	if len(data) < 24 {
+		return nil, fmt.Errorf("抓包文件格式无效")
+	}
+
+	var order binary.ByteOrder
+	var nanos bool
+	switch magic := binary.LittleEndian.Uint32(data); magic {
+	case 0xa1b2c3d4, pcapMagicNanos:
+		order, nanos = binary.LittleEndian, magic == pcapMagicNanos
+	case 0xd4c3b2a1, 0x4d3cb2a1:
+		order, nanos = binary.BigEndian, magic == 0x4d3cb2a1
+	default:
+		return nil, fmt.Errorf("不支持的抓包文件格式，仅支持 pcap (pcapng 请先用 editcap -F pcap 转换)")
+	}
+
+	linkType := order.Uint32(data[20:]) & 0xffff
+	var linkHeader int
+	switch linkType {
+	case linkTypeRaw:
+		linkHeader = 0
+	case 1: // 以太网，不处理VLAN标签
+		linkHeader = 14
+	case 113: // Linux cooked capture
+		linkHeader = 16
+	default:
+		return nil, fmt.Errorf("不支持的链路类型: %d", linkType)
+	}
+
+	var packets []capturedPacket
+	for off := 24; off+16 <= len(data); {
+		sec := order.Uint32(data[off:])
+		frac := order.Uint32(data[off+4:])
+		caplen := int(order.Uint32(data[off+8:]))
+		off += 16
+		if off+caplen > len(data) {
+			break
+		}
+		frame := data[off : off+caplen]
+		off += caplen
+
+		if !nanos {
+			frac *= 1000
+		}
+		if len(frame) <= linkHeader {
+			continue
+		}
+		if pkt, ok := parseIPPacket(frame[linkHeader:]); ok {
+			pkt.ts = time.Unix(int64(sec), int64(frac))
+			packets = append(packets, pkt)
+		}
+	}
+	return packets, nil
+}
+
+// parseIPPacket 从IP报文中取出ICMP部分，不是ICMP或ICMPv6时返回 false。
+// 报文可能被截断(抓包长度限制或差错消息中引用的原始报文)，此时只返回实际存在的部分
+func parseIPPacket(b []byte) (capturedPacket, bool) {
+	switch {
+	case len(b) >= 20 && b[0]>>4 == 4:
+		ihl := int(b[0]&0x0f) * 4
+		end := min(int(binary.BigEndian.Uint16(b[2:])), len(b))
+		fragment := binary.BigEndian.Uint16(b[6:]) & 0x3fff
+		if b[9] != 1 || fragment != 0 || ihl < 20 || end < ihl {
+			return capturedPacket{}, false
+		}
+		return capturedPacket{src: net.IP(b[12:16]), dst: net.IP(b[16:20]), proto: 1, msg: b[ihl:end]}, true
+
+	case len(b) >= 40 && b[0]>>4 == 6:
+		end := min(40+int(binary.BigEndian.Uint16(b[4:])), len(b))
+		if b[6] != 58 {
+			return capturedPacket{}, false
+		}
+		return capturedPacket{src: net.IP(b[8:24]), dst: net.IP(b[24:40]), proto: 58, msg: b[40:end]}, true
+	}
+	return capturedPacket{}, false
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"log/slog"
+	"net/netip"
+	"sync"
+)
+
+// precheck 实现 -precheck: 对输入中展开的每个CIDR，先探测其中地址最小和最大的目标 (通常为网关) 以及
+// -precheck 个随机目标，均无响应时跳过该网段的全部目标，以免逐个探测整段没有主机的地址。
+// 目标数不超过抽样数的网段直接完整探测。返回需要探测的目标，预检有响应的网段的抽样目标也在其中
+func (s *scanner) precheck(targets []target) []target {
+	if *precheckN <= 0 {
+		return targets
+	}
+
+	prefixes := make(map[string][]int)
+	var order []string
+	for i, t := range targets {
+		if t.prefix == "" {
+			continue
+		}
+		if _, ok := prefixes[t.prefix]; !ok {
+			order = append(order, t.prefix)
+		}
+		prefixes[t.prefix] = append(prefixes[t.prefix], i)
+	}
+
+	rng := seededRand()
+	type sample struct {
+		prefix string
+		t      target
+	}
+	var samples []sample
+	for _, prefix := range order {
+		members := prefixes[prefix]
+		if len(members) <= *precheckN+2 {
+			delete(prefixes, prefix)
+			continue
+		}
+		// 输入可能已被 -shuffle 打乱，按地址找出首尾的目标
+		first, last := members[0], members[0]
+		for _, i := range members {
+			addr := parseAddr(targets[i].ip)
+			if addr.Less(parseAddr(targets[first].ip)) {
+				first = i
+			}
+			if parseAddr(targets[last].ip).Less(addr) {
+				last = i
+			}
+		}
+		picked := map[int]bool{first: true, last: true}
+		for len(picked) < *precheckN+2 {
+			picked[members[rng.Intn(len(members))]] = true
+		}
+		for i := range picked {
+			samples = append(samples, sample{prefix, targets[i]})
+		}
+	}
+	if len(samples) == 0 {
+		return targets
+	}
+
+	slog.Info("正在预检网段", "prefixes", len(prefixes), "samples", len(samples))
+	alive := make(map[string]bool)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	jobs := make(chan int)
+	for w := 0; w < min(max(*maxThreads, 1), len(samples)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				sm := samples[i]
+				s.limiter.wait()
+				if _, err := s.probeTarget(sm.t, s.pool.pick(i, sm.t.ip)); err == nil {
+					mu.Lock()
+					alive[sm.prefix] = true
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range samples {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	kept := make([]target, 0, len(targets))
+	skipped, dark := 0, 0
+	for _, t := range targets {
+		if _, checked := prefixes[t.prefix]; checked && !alive[t.prefix] {
+			skipped++
+			continue
+		}
+		kept = append(kept, t)
+	}
+	for prefix := range prefixes {
+		if !alive[prefix] {
+			dark++
+			slog.Debug("网段预检无响应，已跳过", "prefix", prefix, "targets", len(prefixes[prefix]))
+		}
+	}
+	slog.Info("网段预检完成", "prefixes", len(prefixes), "skipped_prefixes", dark, "skipped_targets", skipped)
+	return kept
+}
+
+// parseAddr 解析目标地址，主机名目标返回零值
+func parseAddr(ip string) netip.Addr {
+	addr, _ := netip.ParseAddr(ip)
+	return addr
+}
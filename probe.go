@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// probeFunc 对单个IP执行一次探测，timeout 为本次探测的超时时间，返回耗时以及探测方式附加列的值
+type probeFunc func(ip, src string, timeout time.Duration) (time.Duration, []string, error)
+
+// probeMode 描述一种探测方式，columns 在参数解析后返回附加列的名称，port 为未指定 -port 时的默认端口
+type probeMode struct {
+	probe   probeFunc
+	columns func() []string
+	port    int
+}
+
+// probes 按 -mode 名称注册的探测方式
+var probes = map[string]probeMode{
+	"icmp":      {probe: ping},
+	"xecho":     {probe: extendedPing, columns: func() []string { return []string{"接口状态", "接口协议"} }},
+	"nd":        {probe: ndPing, columns: func() []string { return []string{"MAC地址"} }},
+	"timestamp": {probe: timestampPing, columns: func() []string { return []string{unitColumn("去程延迟"), unitColumn("回程延迟")} }},
+	"tcp":       {probe: tcpPing, port: 80},
+	"http":      {probe: httpPing, columns: httpColumns, port: 80},
+	"quic":      {probe: quicPing, columns: func() []string { return []string{"QUIC版本"} }, port: 443},
+	"dns":       {probe: dnsPing, columns: func() []string { return []string{"应答码"} }, port: 53},
+	"ntp":       {probe: ntpPing, columns: func() []string { return []string{"层级", unitColumn("时钟偏差")} }, port: 123},
+	// sim 不发送报文，按 ICMP_SCAN_SIM 模拟延迟和丢包，仅用于测试，不在 -mode 的帮助中列出
+	"sim": {probe: simPing},
+}
+
+// latencyUnits 为 -unit 支持的延迟单位
+var latencyUnits = map[string]time.Duration{
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+}
+
+// formatLatency 返回供终端和日志阅读的延迟，如 12 ms
+func formatLatency(duration time.Duration) string {
+	return strconv.FormatInt(duration.Milliseconds(), 10) + " ms"
+}
+
+// latencyValue 返回以 -unit 为单位的延迟
+func latencyValue(duration time.Duration) float64 {
+	return float64(duration) / float64(latencyUnits[*unit])
+}
+
+// formatValue 把延迟格式化为以 -unit 为单位、不带单位后缀且与区域设置无关的数字，用于CSV、JSON等供程序读取的输出
+func formatValue(duration time.Duration) string {
+	return strconv.FormatFloat(latencyValue(duration), 'f', -1, 64)
+}
+
+// unitColumn 在延迟列的列名后注明 -unit 单位，如 抖动(ms)
+func unitColumn(name string) string {
+	return name + "(" + *unit + ")"
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var rcodeNames = map[dnsmessage.RCode]string{
+	dnsmessage.RCodeSuccess:        "NOERROR",
+	dnsmessage.RCodeFormatError:    "FORMERR",
+	dnsmessage.RCodeServerFailure:  "SERVFAIL",
+	dnsmessage.RCodeNameError:      "NXDOMAIN",
+	dnsmessage.RCodeNotImplemented: "NOTIMP",
+	dnsmessage.RCodeRefused:        "REFUSED",
+}
+
+var qtypes = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"NS":    dnsmessage.TypeNS,
+	"CNAME": dnsmessage.TypeCNAME,
+	"MX":    dnsmessage.TypeMX,
+	"TXT":   dnsmessage.TypeTXT,
+	"SOA":   dnsmessage.TypeSOA,
+}
+
+// buildQuery 构造对 -query 的递归查询报文
+func buildQuery(id uint16) ([]byte, error) {
+	qtype, ok := qtypes[strings.ToUpper(*qtypeName)]
+	if !ok {
+		return nil, fmt.Errorf("不支持的查询类型: %s", *qtypeName)
+	}
+	fqdn := *query
+	if !strings.HasSuffix(fqdn, ".") {
+		fqdn += "."
+	}
+	name, err := dnsmessage.NewName(fqdn)
+	if err != nil {
+		return nil, fmt.Errorf("无效的查询域名: %v", err)
+	}
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(dnsmessage.Question{Name: name, Type: qtype, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, err
+	}
+	return b.Finish()
+}
+
+// dnsPing 向目标IP发送DNS查询，测量收到应答的耗时并记录应答码
+func dnsPing(ip, src string, timeout time.Duration) (time.Duration, []string, error) {
+	id := uint16(rand.Intn(1 << 16))
+	msg, err := buildQuery(id)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var resp []byte
+	var duration time.Duration
+	if *dnsTCP {
+		resp, duration, err = exchangeTCP(ip, src, timeout, msg)
+	} else {
+		resp, duration, err = exchangeUDP(ip, src, timeout, msg, func(b []byte) bool {
+			return len(b) >= 2 && binary.BigEndian.Uint16(b) == id
+		})
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var p dnsmessage.Parser
+	header, err := p.Start(resp)
+	if err != nil {
+		return 0, nil, fmt.Errorf("解析DNS应答失败: %v", err)
+	}
+	if header.ID != id {
+		return 0, nil, fmt.Errorf("DNS应答ID不匹配")
+	}
+
+	rcode, ok := rcodeNames[header.RCode]
+	if !ok {
+		rcode = strconv.Itoa(int(header.RCode))
+	}
+
+	return duration, []string{rcode}, nil
+}
+
+// exchangeTCP 通过TCP发送带两字节长度前缀的DNS查询，耗时包含建立连接的时间，不包含解析主机名目标的时间
+func exchangeTCP(ip, src string, timeout time.Duration, msg []byte) ([]byte, time.Duration, error) {
+	ip, err := resolveAddr(ip)
+	if err != nil {
+		return nil, 0, err
+	}
+	d := localDialer{src}
+	start := time.Now()
+	conn, err := d.Dial("tcp", net.JoinHostPort(ip, strconv.Itoa(*port)))
+	if err != nil {
+		return nil, 0, fmt.Errorf("TCP连接失败: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(start.Add(timeout))
+
+	buf := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	copy(buf[2:], msg)
+	if _, err := conn.Write(buf); err != nil {
+		return nil, 0, fmt.Errorf("发送DNS查询失败: %v", err)
+	}
+
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, 0, fmt.Errorf("接收DNS应答失败: %v", err)
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, 0, fmt.Errorf("接收DNS应答失败: %v", err)
+	}
+
+	return resp, time.Since(start), nil
+}
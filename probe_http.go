@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// httpCheck 为 -expect-status 和 -expect-body 解析后的响应校验规则
+type httpCheck struct {
+	statuses []string // 期望的状态码，支持 2xx 形式的通配
+	body     *regexp.Regexp
+}
+
+var check *httpCheck
+
+func parseHTTPCheck(statuses, body string) (*httpCheck, error) {
+	if statuses == "" && body == "" {
+		return nil, nil
+	}
+
+	c := &httpCheck{}
+	for _, s := range strings.Split(statuses, ",") {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s == "" {
+			continue
+		}
+		if len(s) != 3 || strings.Trim(s, "0123456789x") != "" {
+			return nil, fmt.Errorf("无效的状态码: %s", s)
+		}
+		c.statuses = append(c.statuses, s)
+	}
+
+	if body != "" {
+		re, err := regexp.Compile(body)
+		if err != nil {
+			return nil, fmt.Errorf("无效的响应体正则: %v", err)
+		}
+		c.body = re
+	}
+
+	return c, nil
+}
+
+func (c *httpCheck) statusOK(code int) bool {
+	if len(c.statuses) == 0 {
+		return true
+	}
+	got := strconv.Itoa(code)
+	for _, want := range c.statuses {
+		match := true
+		for i := range want {
+			if want[i] != 'x' && want[i] != got[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+func httpColumns() []string {
+	if check == nil {
+		return []string{"状态码"}
+	}
+	return []string{"状态码", "校验结果"}
+}
+
+// httpPing 测量发出HTTP请求到收到响应头的耗时，包含建立连接的时间。
+// 主机名目标在计时前解析，URL、Host 头和 SNI 仍使用主机名
+func httpPing(ip, src string, timeout time.Duration) (time.Duration, []string, error) {
+	dialAddr := net.JoinHostPort(ip, strconv.Itoa(*port))
+	if proxyURL == nil {
+		addr, err := resolveAddr(ip)
+		if err != nil {
+			return 0, nil, err
+		}
+		dialAddr = net.JoinHostPort(addr, strconv.Itoa(*port))
+	}
+	scheme := "http"
+	if *useTLS {
+		scheme = "https"
+	}
+
+	req, err := http.NewRequest(http.MethodGet, scheme+"://"+urlHost(ip, strconv.Itoa(*port))+"/", nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("构造HTTP请求失败: %v", err)
+	}
+	if *hostHeader != "" {
+		req.Host = *hostHeader
+	}
+
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dialTarget(ctx, src, dialAddr)
+			},
+			// 按IP探测时证书通常无法匹配，只关心延迟因此跳过证书校验
+			TLSClientConfig:   &tls.Config{ServerName: *hostHeader, InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("HTTP请求失败: %v", err)
+	}
+	duration := time.Since(start)
+	defer resp.Body.Close()
+
+	status := strconv.Itoa(resp.StatusCode)
+	if check == nil {
+		io.Copy(io.Discard, resp.Body)
+		return duration, []string{status}, nil
+	}
+
+	verdict := "通过"
+	if !check.statusOK(resp.StatusCode) {
+		verdict = "失败"
+		slog.Debug("校验失败: 状态码不符合预期", "ip", ip, "status", resp.StatusCode)
+	} else if check.body != nil {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		if err != nil {
+			return 0, nil, fmt.Errorf("读取HTTP响应失败: %v", err)
+		}
+		if !check.body.Match(body) {
+			verdict = "失败"
+			slog.Debug("校验失败: 响应体不匹配", "ip", ip, "pattern", check.body.String())
+		}
+	}
+
+	return duration, []string{status, verdict}, nil
+}
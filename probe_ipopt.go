@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// IPv4 选项类型 (RFC 791)
+const (
+	optionRecordRoute = 7
+	optionTimestamp   = 68
+)
+
+// ipOptionColumns 为 -ip-option 支持的选项及其附加列的名称
+var ipOptionColumns = map[string]string{
+	"rr": "记录路由",
+	"ts": "时间戳",
+}
+
+// optionSeq 为带选项的回显请求的序号，这些请求不经过共享套接字分配序号
+var optionSeq atomic.Uint32
+
+// validateIPOption 检查 -ip-option，返回其附加列的名称
+func validateIPOption() (string, error) {
+	column, ok := ipOptionColumns[*ipOption]
+	if !ok {
+		return "", fmt.Errorf("未知的IP选项: %s，可用 rr 或 ts", *ipOption)
+	}
+	if *mode != "icmp" {
+		return "", fmt.Errorf("-ip-option 仅支持 -mode icmp")
+	}
+	return column, nil
+}
+
+// requestOption 构造 -ip-option 对应的空选项，由沿途的路由器和目标填写。
+// 选项区最长40字节，记录路由最多9个地址，时间戳使用 地址+时间 的格式，最多4组
+func requestOption() []byte {
+	if *ipOption == "rr" {
+		opt := make([]byte, 40)
+		opt[0], opt[1], opt[2] = optionRecordRoute, 39, 4
+		return opt
+	}
+	opt := make([]byte, 36)
+	opt[0], opt[1], opt[2], opt[3] = optionTimestamp, 36, 5, 1
+	return opt
+}
+
+// decodeOptions 从应答的IP选项中取出记录的地址或时间戳，以空格分隔。
+// 时间戳为自UTC零点起的毫秒数，格式为 地址@毫秒；记录已满时末尾加上 +溢出数
+func decodeOptions(options []byte) string {
+	for len(options) > 0 {
+		kind := options[0]
+		if kind == 0 {
+			break
+		}
+		if kind == 1 || len(options) < 2 {
+			options = options[1:]
+			continue
+		}
+		size := int(options[1])
+		if size < 2 || size > len(options) {
+			break
+		}
+		opt := options[:size]
+		options = options[size:]
+
+		var fields []string
+		switch {
+		case kind == optionRecordRoute && size >= 3:
+			end := min(int(opt[2])-1, size)
+			for i := 3; i+4 <= end; i += 4 {
+				fields = append(fields, net.IP(opt[i:i+4]).String())
+			}
+		case kind == optionTimestamp && size >= 4:
+			end := min(int(opt[2])-1, size)
+			for i := 4; i+8 <= end; i += 8 {
+				ms := binary.BigEndian.Uint32(opt[i+4 : i+8])
+				fields = append(fields, net.IP(opt[i:i+4]).String()+"@"+strconv.FormatUint(uint64(ms), 10))
+			}
+			if overflow := opt[3] >> 4; overflow > 0 {
+				fields = append(fields, "+"+strconv.Itoa(int(overflow)))
+			}
+		default:
+			continue
+		}
+		return strings.Join(fields, " ")
+	}
+	return ""
+}
+
+// optionPing 发送带 -ip-option 选项的ICMP回显请求，并把应答中回填的记录路由或时间戳写入附加列。
+// 需要自行构造IP头部，因此每次探测使用单独的原始套接字，速度远低于普通的 icmp 探测，适合少量目标的路径诊断。
+// 许多路由器会丢弃或忽略带选项的报文，未记录时该列为空。IPv6 没有对应的选项，按普通回显请求探测
+func optionPing(ip, src string, timeout time.Duration) (time.Duration, []string, error) {
+	if strings.Contains(ip, ":") {
+		duration, _, err := ping(ip, src, timeout)
+		return duration, []string{""}, err
+	}
+	if src == "" {
+		src = "0.0.0.0"
+	}
+	dst, err := net.ResolveIPAddr("ip4", ip)
+	if err != nil {
+		return 0, nil, fmt.Errorf("解析IP地址失败: %v", err)
+	}
+
+	conn, err := listen("ip4:icmp", src)
+	if err != nil {
+		return 0, nil, fmt.Errorf("创建ICMP连接失败: %v", err)
+	}
+	defer conn.Close()
+	raw, err := ipv4.NewRawConn(conn)
+	if err != nil {
+		return 0, nil, fmt.Errorf("当前系统不支持发送带IP选项的报文: %v", err)
+	}
+
+	id, seq := icmpID(), int(optionSeq.Add(1)&0xffff)
+	wm := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: echoPayload()},
+	}
+	wb, err := wm.Marshal(nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("序列化ICMP消息失败: %v", err)
+	}
+	options := requestOption()
+	header := &ipv4.Header{
+		Version:  ipv4.Version,
+		Len:      ipv4.HeaderLen + len(options),
+		TotalLen: ipv4.HeaderLen + len(options) + len(wb),
+		TTL:      64,
+		Protocol: 1,
+		Dst:      dst.IP.To4(),
+		Options:  options,
+	}
+	// 内核为源地址为空的报文按路由选择源地址
+	if local := net.ParseIP(src); local != nil && !local.IsUnspecified() {
+		header.Src = local.To4()
+	}
+
+	start := time.Now()
+	if err := raw.WriteTo(header, wb, nil); err != nil {
+		return 0, nil, fmt.Errorf("发送ICMP请求失败: %v", err)
+	}
+	raw.SetReadDeadline(start.Add(timeout))
+
+	buf := make([]byte, 1500)
+	for {
+		h, payload, _, err := raw.ReadFrom(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return 0, nil, fmt.Errorf("接收ICMP回复失败: %w", errTimeout)
+			}
+			return 0, nil, fmt.Errorf("接收ICMP回复失败: %v", err)
+		}
+		received := time.Now()
+		m, ok := matchEcho(1, payload)
+		if !ok || m.extended || m.id != id || m.seq != seq || !ownEcho(m) {
+			continue
+		}
+		if m.target != nil {
+			if m.target.Equal(dst.IP) {
+				return 0, nil, m.err
+			}
+			continue
+		}
+		if !h.Src.Equal(dst.IP) {
+			continue
+		}
+		return received.Sub(start), []string{decodeOptions(h.Options)}, nil
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+)
+
+// onLinkPrefix 为本机接口上配置的一个IPv6前缀
+type onLinkPrefix struct {
+	iface  net.Interface
+	prefix *net.IPNet
+}
+
+// onLinkPrefixes 在首次使用时读取 -netns 中各接口上配置的IPv6前缀
+var onLinkPrefixes = sync.OnceValue(func() []onLinkPrefix {
+	var prefixes []onLinkPrefix
+	err := withNetns(*netns, func() error {
+		ifaces, err := net.Interfaces()
+		if err != nil {
+			return err
+		}
+		for _, iface := range ifaces {
+			if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+				continue
+			}
+			addrs, err := iface.Addrs()
+			if err != nil {
+				continue
+			}
+			for _, addr := range addrs {
+				ipnet, ok := addr.(*net.IPNet)
+				if !ok || ipnet.IP.To4() != nil || ipnet.IP.IsLinkLocalUnicast() {
+					continue
+				}
+				if ones, bits := ipnet.Mask.Size(); ones == bits {
+					continue
+				}
+				prefixes = append(prefixes, onLinkPrefix{iface, ipnet})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Warn("无法读取本机接口的IPv6前缀", "err", err)
+	}
+	return prefixes
+})
+
+// onLinkInterface 返回与IPv6目标处于同一链路的接口。带区域的链路本地地址 (如 fe80::1%eth0) 使用区域指定的接口
+func onLinkInterface(dst *net.IPAddr) (*net.Interface, bool) {
+	if dst.IP.To4() != nil {
+		return nil, false
+	}
+	if dst.IP.IsLinkLocalUnicast() {
+		if dst.Zone == "" {
+			return nil, false
+		}
+		var iface *net.Interface
+		err := withNetns(*netns, func() error {
+			var err error
+			iface, err = net.InterfaceByName(dst.Zone)
+			return err
+		})
+		return iface, err == nil
+	}
+	for _, p := range onLinkPrefixes() {
+		if p.prefix.Contains(dst.IP) {
+			return &p.iface, true
+		}
+	}
+	return nil, false
+}
+
+// ndSocket 为同一源地址上所有邻居请求共享的ICMPv6套接字，按邻居通告中的目标地址把应答交给等待中的探测
+type ndSocket struct {
+	conn     net.PacketConn
+	kernelTS bool
+
+	mu      sync.Mutex
+	pending map[string]chan ndReply
+}
+
+// ndReply 为收到的邻居通告，mac 为其中携带的目标链路层地址
+type ndReply struct {
+	mac net.HardwareAddr
+	at  time.Time
+}
+
+var ndSockets = struct {
+	sync.Mutex
+	m map[string]*ndSocket
+}{m: make(map[string]*ndSocket)}
+
+// ndSocketFor 返回源地址对应的共享套接字，首次使用时创建并启动接收协程。
+// 邻居发现报文的跳数限制必须为255，否则会被接收方丢弃
+func ndSocketFor(src string) (*ndSocket, error) {
+	ndSockets.Lock()
+	defer ndSockets.Unlock()
+
+	if s, ok := ndSockets.m[src]; ok {
+		return s, nil
+	}
+
+	conn, err := listen("ip6:ipv6-icmp", src)
+	if err != nil {
+		return nil, err
+	}
+	pc := ipv6.NewPacketConn(conn)
+	if err := pc.SetMulticastHopLimit(255); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := pc.SetHopLimit(255); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	s := &ndSocket{
+		conn:     conn,
+		kernelTS: *kernelTime && enableKernelTimestamps(conn),
+		pending:  make(map[string]chan ndReply),
+	}
+	go s.readLoop()
+	ndSockets.m[src] = s
+	return s, nil
+}
+
+func (s *ndSocket) readLoop() {
+	buf := make([]byte, 1500)
+	for {
+		n, _, at, err := readTimestamped(s.conn, buf, s.kernelTS)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			slog.Debug("读取ICMPv6套接字失败", "err", err)
+			continue
+		}
+
+		target, mac, ok := parseNeighborAdvert(buf[:n])
+		if !ok {
+			continue
+		}
+		s.mu.Lock()
+		ch, ok := s.pending[target.String()]
+		delete(s.pending, target.String())
+		s.mu.Unlock()
+		if ok {
+			ch <- ndReply{mac, at}
+		}
+	}
+}
+
+// parseNeighborAdvert 解析邻居通告，返回其目标地址和目标链路层地址选项中的MAC地址
+func parseNeighborAdvert(b []byte) (net.IP, net.HardwareAddr, bool) {
+	if len(b) < 24 || b[0] != byte(ipv6.ICMPTypeNeighborAdvertisement) || b[1] != 0 {
+		return nil, nil, false
+	}
+	target := net.IP(append([]byte(nil), b[8:24]...))
+
+	var mac net.HardwareAddr
+	for opts := b[24:]; len(opts) >= 8; {
+		l := int(opts[1]) * 8
+		if l == 0 || l > len(opts) {
+			break
+		}
+		// 类型2为目标链路层地址
+		if opts[0] == 2 {
+			mac = net.HardwareAddr(append([]byte(nil), opts[2:l]...))
+			if len(mac) > 6 {
+				mac = mac[:6]
+			}
+		}
+		opts = opts[l:]
+	}
+	return target, mac, true
+}
+
+// solicitedNode 返回IPv6地址对应的被请求节点组播地址 ff02::1:ffXX:XXXX
+func solicitedNode(ip net.IP) net.IP {
+	group := net.ParseIP("ff02::1:ff00:0")
+	copy(group[13:], ip.To16()[13:])
+	return group
+}
+
+// ndPing 对与本机处于同一链路的IPv6目标发送邻居请求，以邻居通告的到达作为存活判断并报告其MAC地址，
+// 可以发现过滤了回显请求但必须应答邻居发现的主机。其他目标回退为普通的ICMP回显探测
+func ndPing(ip, src string, timeout time.Duration) (time.Duration, []string, error) {
+	dst, err := net.ResolveIPAddr("ip6", ip)
+	if err != nil || !strings.Contains(ip, ":") {
+		duration, _, err := ping(ip, src, timeout)
+		return duration, []string{""}, err
+	}
+	iface, ok := onLinkInterface(dst)
+	if !ok {
+		duration, _, err := ping(ip, src, timeout)
+		return duration, []string{""}, err
+	}
+
+	if src == "" {
+		src = "::"
+	}
+	sock, err := ndSocketFor(src)
+	if err != nil {
+		return 0, nil, fmt.Errorf("创建ICMPv6连接失败: %v", err)
+	}
+
+	target := dst.IP.String()
+	wait := make(chan ndReply, 1)
+	sock.mu.Lock()
+	if _, busy := sock.pending[target]; busy {
+		sock.mu.Unlock()
+		return 0, nil, fmt.Errorf("已有发往 %s 的邻居请求在等待应答", target)
+	}
+	sock.pending[target] = wait
+	sock.mu.Unlock()
+	defer func() {
+		sock.mu.Lock()
+		if sock.pending[target] == wait {
+			delete(sock.pending, target)
+		}
+		sock.mu.Unlock()
+	}()
+
+	// 邻居请求: 4字节保留字段、目标地址，以及携带本机MAC地址的源链路层地址选项(类型1)
+	body := append(make([]byte, 4), dst.IP.To16()...)
+	if len(iface.HardwareAddr) == 6 {
+		body = append(body, 1, 1)
+		body = append(body, iface.HardwareAddr...)
+	}
+	wm := icmp.Message{
+		Type: ipv6.ICMPTypeNeighborSolicitation,
+		Body: &icmp.RawBody{Data: body},
+	}
+	// 校验和由内核填写
+	wb, err := wm.Marshal(nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("序列化邻居请求失败: %v", err)
+	}
+
+	start := time.Now()
+	group := &net.IPAddr{IP: solicitedNode(dst.IP), Zone: iface.Name}
+	if _, err := sock.conn.WriteTo(wb, group); err != nil {
+		return 0, nil, fmt.Errorf("发送邻居请求失败: %v", err)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case reply := <-wait:
+		return reply.at.Sub(start), []string{reply.mac.String()}, nil
+	case <-timer.C:
+		return 0, nil, fmt.Errorf("接收邻居通告失败: %w", errTimeout)
+	}
+}
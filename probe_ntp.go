@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ntpEpochOffset 为 NTP 纪元(1900年)与 Unix 纪元之间的秒数
+const ntpEpochOffset = 2208988800
+
+func toNTPTime(t time.Time) uint64 {
+	secs := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / 1e9
+	return secs<<32 | frac
+}
+
+func fromNTPTime(v uint64) time.Time {
+	secs := int64(v>>32) - ntpEpochOffset
+	nsec := (v & 0xffffffff) * 1e9 >> 32
+	return time.Unix(secs, int64(nsec))
+}
+
+// ntpPing 发送 NTPv4 客户端请求，以 (T4-T1)-(T3-T2) 计算往返延迟，并记录服务器层级和时钟偏差。
+// T4-T1 取 exchangeUDP 从发送到接收的单调时钟间隔，不包含创建套接字和解析地址的时间，也不受本机时钟调整的影响
+func ntpPing(ip, src string, timeout time.Duration) (time.Duration, []string, error) {
+	req := make([]byte, 48)
+	req[0] = 0x23 // LI=0, VN=4, Mode=3(客户端)
+	origin := toNTPTime(time.Now())
+	binary.BigEndian.PutUint64(req[40:], origin)
+
+	resp, rtt, err := exchangeUDP(ip, src, timeout, req, func(b []byte) bool {
+		return len(b) >= 48 && binary.BigEndian.Uint64(b[24:]) == origin
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	// 计算时钟偏差需要本机的时间，T1 由收到应答的时间和往返间隔倒推
+	t4 := time.Now().Round(0)
+	t1 := t4.Add(-rtt)
+
+	if resp[0]&0x07 != 4 {
+		return 0, nil, fmt.Errorf("不是NTP服务器应答")
+	}
+	stratum := resp[1]
+	if stratum == 0 {
+		// stratum 为0表示 Kiss-o'-Death，参考ID中为原因码
+		return 0, nil, fmt.Errorf("服务器拒绝服务: %s", resp[12:16])
+	}
+
+	t2 := fromNTPTime(binary.BigEndian.Uint64(resp[32:]))
+	t3 := fromNTPTime(binary.BigEndian.Uint64(resp[40:]))
+
+	delay := rtt - t3.Sub(t2)
+	if delay < 0 {
+		delay = 0
+	}
+	offset := (t2.Sub(t1) + t3.Sub(t4)) / 2
+
+	return delay, []string{strconv.Itoa(int(stratum)), formatValue(offset)}, nil
+}
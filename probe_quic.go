@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// quicPing 测量与 ip:port 完成QUIC握手的耗时，并记录协商出的QUIC版本
+func quicPing(ip, src string, timeout time.Duration) (time.Duration, []string, error) {
+	network, local := "udp4", "0.0.0.0"
+	if strings.Contains(ip, ":") {
+		network, local = "udp6", "::"
+	}
+	if src != "" {
+		local = src
+	}
+
+	conn, err := listen(network, net.JoinHostPort(local, "0"))
+	if err != nil {
+		return 0, nil, fmt.Errorf("创建UDP连接失败: %v", err)
+	}
+	defer conn.Close()
+
+	dst, err := net.ResolveUDPAddr(network, net.JoinHostPort(ip, strconv.Itoa(*port)))
+	if err != nil {
+		return 0, nil, fmt.Errorf("解析IP地址失败: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	tlsConf := &tls.Config{
+		ServerName: *hostHeader,
+		NextProtos: []string{"h3"},
+		// 按IP探测时证书通常无法匹配，只关心握手延迟因此跳过证书校验
+		InsecureSkipVerify: true,
+	}
+
+	start := time.Now()
+	qc, err := quic.Dial(ctx, conn, dst, tlsConf, &quic.Config{HandshakeIdleTimeout: timeout})
+	if err != nil {
+		return 0, nil, fmt.Errorf("QUIC握手失败: %v", err)
+	}
+	duration := time.Since(start)
+	version := qc.ConnectionState().Version.String()
+	qc.CloseWithError(0, "")
+
+	return duration, []string{version}, nil
+}
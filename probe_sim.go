@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// simEnv 为 -mode sim 的配置所在的环境变量。sim 是不出现在帮助中的内部探测方式，不发送任何报文，
+// 按配置模拟延迟分布和丢包，用于在大规模目标上确定性地测试调度、统计和输出
+const simEnv = "ICMP_SCAN_SIM"
+
+// simConfig 为模拟网络的参数: 每个目标的基准延迟在 [minRTT, maxRTT] 中按地址固定选取，
+// 每次探测在其上叠加标准差为 jitter 的正态分布抖动，loss 为单次探测的丢包率，down 为从不响应的目标的比例。
+// sleep 为 false 时立即返回而不等待模拟的延迟
+type simConfig struct {
+	minRTT, maxRTT time.Duration
+	jitter         time.Duration
+	loss, down     float64
+	sleep          bool
+}
+
+var (
+	simOnce     sync.Once
+	simSettings simConfig
+	simErr      error
+	// simAttempts 记录每个目标已模拟的探测次数，同一目标的第 n 次探测的结果只取决于种子、地址和 n
+	simAttempts = struct {
+		sync.Mutex
+		m map[string]uint64
+	}{m: make(map[string]uint64)}
+)
+
+// parseSimConfig 解析 ICMP_SCAN_SIM，如 rtt=10ms-200ms,jitter=2ms,loss=1,down=20,sleep=false，未指定的参数使用默认值
+func parseSimConfig(s string) (simConfig, error) {
+	c := simConfig{minRTT: 20 * time.Millisecond, maxRTT: 20 * time.Millisecond, sleep: true}
+	for _, part := range strings.Split(s, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		var err error
+		switch name {
+		case "":
+			continue
+		case "rtt":
+			lo, hi, isRange := strings.Cut(value, "-")
+			if c.minRTT, err = time.ParseDuration(lo); err == nil {
+				c.maxRTT = c.minRTT
+				if isRange {
+					c.maxRTT, err = time.ParseDuration(hi)
+				}
+			}
+			if err == nil && (c.minRTT < 0 || c.maxRTT < c.minRTT) {
+				err = fmt.Errorf("范围无效")
+			}
+		case "jitter":
+			c.jitter, err = time.ParseDuration(value)
+		case "loss":
+			c.loss, err = parsePercent(value)
+		case "down":
+			c.down, err = parsePercent(value)
+		case "sleep":
+			c.sleep, err = strconv.ParseBool(value)
+		default:
+			return c, fmt.Errorf("%s 中未知的参数: %s", simEnv, name)
+		}
+		if err != nil {
+			return c, fmt.Errorf("%s 中无效的 %s: %s", simEnv, name, value)
+		}
+	}
+	return c, nil
+}
+
+// parsePercent 解析 0 到 100 之间的百分比，返回比例
+func parsePercent(s string) (float64, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 || v > 100 {
+		return 0, fmt.Errorf("无效的百分比: %s", s)
+	}
+	return v / 100, nil
+}
+
+// simRand 返回由种子、地址和序号决定的随机数生成器
+func simRand(ip string, n uint64) *rand.Rand {
+	h := fnv.New64a()
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(*seed))
+	h.Write(b[:])
+	h.Write([]byte(ip))
+	binary.BigEndian.PutUint64(b[:], n)
+	h.Write(b[:])
+	return rand.New(rand.NewSource(int64(h.Sum64())))
+}
+
+// simPing 模拟一次探测。从不响应的目标和丢包的探测在等待 timeout 后返回超时，延迟超过 timeout 的也视为超时
+func simPing(ip, src string, timeout time.Duration) (time.Duration, []string, error) {
+	simOnce.Do(func() {
+		simSettings, simErr = parseSimConfig(os.Getenv(simEnv))
+	})
+	if simErr != nil {
+		return 0, nil, simErr
+	}
+	c := simSettings
+
+	simAttempts.Lock()
+	simAttempts.m[ip]++
+	n := simAttempts.m[ip]
+	simAttempts.Unlock()
+
+	host := simRand(ip, 0)
+	base := c.minRTT + time.Duration(host.Int63n(int64(c.maxRTT-c.minRTT)+1))
+	down := host.Float64() < c.down
+
+	r := simRand(ip, n)
+	rtt := base + time.Duration(r.NormFloat64()*float64(c.jitter))
+	rtt = max(rtt, 0)
+	if down || r.Float64() < c.loss || rtt > timeout {
+		if c.sleep {
+			time.Sleep(timeout)
+		}
+		return 0, nil, fmt.Errorf("接收模拟应答失败: %w", errTimeout)
+	}
+	if c.sleep {
+		time.Sleep(rtt)
+	}
+	return rtt, nil, nil
+}
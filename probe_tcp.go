@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// tcpPing 测量与 ip:port 完成TCP握手的耗时，配置了代理时为经代理建立连接的耗时。
+// 主机名目标在计时前解析，经代理时由代理解析，解析时间包含在内
+func tcpPing(ip, src string, timeout time.Duration) (time.Duration, []string, error) {
+	if proxyURL == nil {
+		var err error
+		if ip, err = resolveAddr(ip); err != nil {
+			return 0, nil, err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	conn, err := dialTarget(ctx, src, net.JoinHostPort(ip, strconv.Itoa(*port)))
+	if err != nil {
+		return 0, nil, fmt.Errorf("TCP连接失败: %v", err)
+	}
+	duration := time.Since(start)
+	conn.Close()
+
+	return duration, nil, nil
+}
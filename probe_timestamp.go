@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// msPerDay 为ICMP时间戳的取值范围: 自UTC午夜起的毫秒数
+const msPerDay = 24 * 60 * 60 * 1000
+
+// nonStandardTime 为时间戳最高位，置位表示对端不能给出UTC午夜起的毫秒数，时间戳无法与本机比较
+const nonStandardTime = 1 << 31
+
+// icmpTimestamp 返回 t 自UTC午夜起的毫秒数
+func icmpTimestamp(t time.Time) uint32 {
+	t = t.UTC()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return uint32(t.Sub(midnight).Milliseconds())
+}
+
+// timestampDiff 返回 b-a，跨越UTC午夜时按最近的一侧计算
+func timestampDiff(a, b int64) time.Duration {
+	d := ((b-a)%msPerDay + msPerDay) % msPerDay
+	if d > msPerDay/2 {
+		d -= msPerDay
+	}
+	return time.Duration(d) * time.Millisecond
+}
+
+// localClockOffset 为 -ts-ntp 服务器时间与本机时间之差，整个扫描只查询一次
+var localClockOffset = sync.OnceValues(func() (time.Duration, error) {
+	if *tsNTP == "" {
+		return 0, nil
+	}
+	return ntpClockOffset(*tsNTP)
+})
+
+// ntpClockOffset 向 NTP 服务器查询一次本机时钟的偏差，server 可以带端口，默认为123
+func ntpClockOffset(server string) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(strings.Trim(server, "[]"), "123")
+	}
+	var conn net.Conn
+	err := withNetns(*netns, func() error {
+		var err error
+		conn, err = net.DialTimeout("udp", server, *timeout)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("连接NTP服务器失败: %v", err)
+	}
+	defer conn.Close()
+
+	req := make([]byte, 48)
+	req[0] = 0x23 // LI=0, VN=4, Mode=3(客户端)
+	t1 := time.Now()
+	origin := toNTPTime(t1)
+	binary.BigEndian.PutUint64(req[40:], origin)
+	if _, err := conn.Write(req); err != nil {
+		return 0, fmt.Errorf("发送NTP请求失败: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(*timeout))
+	resp := make([]byte, 512)
+	for {
+		n, err := conn.Read(resp)
+		if err != nil {
+			return 0, fmt.Errorf("接收NTP应答失败: %v", err)
+		}
+		if n >= 48 && binary.BigEndian.Uint64(resp[24:]) == origin && resp[1] != 0 {
+			break
+		}
+	}
+	t4 := time.Now()
+	t2 := fromNTPTime(binary.BigEndian.Uint64(resp[32:]))
+	t3 := fromNTPTime(binary.BigEndian.Uint64(resp[40:]))
+	return (t2.Sub(t1) + t3.Sub(t4)) / 2, nil
+}
+
+// timestampPing 发送ICMP时间戳请求 (仅IPv4)，以往返时间为延迟，并用对端的接收和发送时间戳把往返时间分为
+// 去程 (T2-T1) 和回程 (T4-T3)。这要求两端的时钟都与UTC同步，本机时钟可由 -ts-ntp 校正；时间戳只精确到毫秒。
+// 对端给出非标准时间或算出的某一段为负 (对端时钟不准) 时，去程和回程列为空
+func timestampPing(ip, src string, timeout time.Duration) (time.Duration, []string, error) {
+	if strings.Contains(ip, ":") {
+		return 0, nil, fmt.Errorf("ICMP时间戳请求仅支持IPv4")
+	}
+	offset, err := localClockOffset()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	rtt, msg, err := exchangeEcho(ip, src, timeout, false, func(v6 bool, id, seq int) icmp.Message {
+		b := make([]byte, 16)
+		binary.BigEndian.PutUint16(b[0:], uint16(id))
+		binary.BigEndian.PutUint16(b[2:], uint16(seq))
+		binary.BigEndian.PutUint32(b[4:], icmpTimestamp(time.Now()))
+		return icmp.Message{Type: ipv4.ICMPTypeTimestamp, Body: &icmp.RawBody{Data: b}}
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	// T1 由收到应答的时间和往返间隔倒推，与 ntpPing 相同，比请求中只到毫秒的发起时间戳更准确
+	t4 := time.Now().Round(0).Add(offset)
+	t1 := t4.Add(-rtt)
+
+	rm, err := icmp.ParseMessage(1, msg)
+	if err != nil {
+		return 0, nil, fmt.Errorf("解析时间戳应答失败: %v", err)
+	}
+	body, ok := rm.Body.(*icmp.RawBody)
+	if rm.Type != ipv4.ICMPTypeTimestampReply || !ok || len(body.Data) < 16 {
+		return 0, nil, fmt.Errorf("解析时间戳应答失败: 消息类型为 %v", rm.Type)
+	}
+	received := binary.BigEndian.Uint32(body.Data[8:])
+	transmitted := binary.BigEndian.Uint32(body.Data[12:])
+	if received&nonStandardTime != 0 || transmitted&nonStandardTime != 0 {
+		return rtt, []string{"", ""}, nil
+	}
+
+	day := t1.UTC().Truncate(24 * time.Hour)
+	t1ms := t1.Sub(day).Milliseconds()
+	t4ms := t4.Sub(day).Milliseconds()
+	forward := timestampDiff(t1ms, int64(received))
+	back := timestampDiff(int64(transmitted), t4ms)
+	if forward < 0 || back < 0 {
+		return rtt, []string{"", ""}, nil
+	}
+	return rtt, []string{formatValue(forward), formatValue(back)}, nil
+}
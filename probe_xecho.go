@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// RFC 8335 接口标识对象的子类型
+const (
+	identByName    = 1
+	identByIndex   = 2
+	identByAddress = 3
+)
+
+// extendedEchoCodes 为扩展回显应答中非0代码的含义
+var extendedEchoCodes = map[int]string{
+	1: "查询格式错误",
+	2: "接口不存在",
+	3: "表项不存在",
+	4: "匹配多个接口",
+}
+
+// interfaceIdent 根据 -xecho-if 构造要查询的接口标识，未设置时按目标地址查询
+func interfaceIdent(ip string) *icmp.InterfaceIdent {
+	query := *xechoIf
+	if query == "" {
+		query = ip
+	}
+
+	if addr := net.ParseIP(query); addr != nil {
+		afi, b := 1, []byte(addr.To4())
+		if b == nil {
+			afi, b = 2, []byte(addr.To16())
+		}
+		return &icmp.InterfaceIdent{Class: 3, Type: identByAddress, AFI: afi, Addr: b}
+	}
+	if index, err := strconv.Atoi(query); err == nil {
+		return &icmp.InterfaceIdent{Class: 3, Type: identByIndex, Index: index}
+	}
+	return &icmp.InterfaceIdent{Class: 3, Type: identByName, Name: query}
+}
+
+// extendedPing 发送 RFC 8335 扩展回显请求 (PROBE)，查询目标节点上 -xecho-if 指定接口的状态。
+// 目标返回了扩展回显应答即视为存活，查询失败的原因写入接口状态列
+func extendedPing(ip, src string, timeout time.Duration) (time.Duration, []string, error) {
+	duration, msg, err := exchangeEcho(ip, src, timeout, true, func(v6 bool, id, seq int) icmp.Message {
+		var msgType icmp.Type = ipv4.ICMPTypeExtendedEchoRequest
+		if v6 {
+			msgType = ipv6.ICMPTypeExtendedEchoRequest
+		}
+		return icmp.Message{
+			Type: msgType,
+			Body: &icmp.ExtendedEchoRequest{
+				ID:         id,
+				Seq:        seq,
+				Local:      true,
+				Extensions: []icmp.Extension{interfaceIdent(ip)},
+			},
+		}
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	proto := 1
+	if strings.Contains(ip, ":") {
+		proto = 58
+	}
+	rm, err := icmp.ParseMessage(proto, msg)
+	if err != nil {
+		return 0, nil, fmt.Errorf("解析扩展回显应答失败: %v", err)
+	}
+	reply, ok := rm.Body.(*icmp.ExtendedEchoReply)
+	if !ok {
+		return 0, nil, fmt.Errorf("解析扩展回显应答失败: 消息类型为 %v", rm.Type)
+	}
+
+	if rm.Code != 0 {
+		state, ok := extendedEchoCodes[rm.Code]
+		if !ok {
+			state = "代码" + strconv.Itoa(rm.Code)
+		}
+		return duration, []string{state, ""}, nil
+	}
+
+	state := "非活动"
+	if reply.Active {
+		state = "活动"
+	}
+	var families []string
+	if reply.IPv4 {
+		families = append(families, "IPv4")
+	}
+	if reply.IPv6 {
+		families = append(families, "IPv6")
+	}
+	return duration, []string{state, strings.Join(families, "/")}, nil
+}
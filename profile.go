@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// profiles 为 -profile 预设的参数组合，命令行上显式指定的参数优先于预设
+var profiles = map[string]map[string]string{
+	// 快速筛选大量目标，只探测一次且很快放弃无响应的目标
+	"fast": {"count": "1", "timeout": "500ms", "retries": "0", "rate": "0", "max": "500"},
+	// 每个目标多次探测并重试，得到更可靠的延迟和丢包率
+	"thorough": {"count": "5", "timeout": "2s", "retries": "2", "rate": "0", "max": "100"},
+	// 低速、低并发并打乱顺序，避免触发入侵检测或ICMP限速
+	"stealth": {"count": "1", "timeout": "3s", "retries": "1", "rate": "10", "max": "10", "shuffle": "true"},
+	// 适合定时对少量目标持续监测，多次探测以反映抖动和丢包
+	"monitor": {"count": "10", "timeout": "1s", "retries": "0", "rate": "50", "max": "20"},
+}
+
+// applyProfile 把 -profile 的预设写入未在命令行上显式指定的参数
+func applyProfile() error {
+	if *profile == "" {
+		return nil
+	}
+	preset, ok := profiles[*profile]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("未知的预设: %s，可用的预设: %s", *profile, strings.Join(names, ", "))
+	}
+
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	for name, value := range preset {
+		if explicit[name] {
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("无法应用预设 %s: %v", *profile, err)
+		}
+	}
+	slog.Debug("已应用预设", "profile", *profile, "count", *probeCount, "timeout", *timeout, "retries", *retries, "rate", *rate, "max", *maxThreads)
+	return nil
+}
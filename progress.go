@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// progressEvent 为 -progress json 输出到 stderr 的进度记录
+type progressEvent struct {
+	Done    int64   `json:"done"`
+	Total   int64   `json:"total"`
+	PPS     float64 `json:"pps"`
+	ETA     float64 `json:"eta"`
+	Elapsed float64 `json:"elapsed"`
+}
+
+// reportProgress 按固定间隔输出JSON进度记录，直到 stop 被关闭，退出前输出最终记录
+func reportProgress(done, total *atomic.Int64, interval time.Duration, stop <-chan struct{}) {
+	start := time.Now()
+	encoder := json.NewEncoder(os.Stderr)
+
+	emit := func() {
+		n, total := done.Load(), total.Load()
+		elapsed := time.Since(start).Seconds()
+		event := progressEvent{Done: n, Total: total, Elapsed: elapsed}
+		if elapsed > 0 {
+			event.PPS = float64(n) / elapsed
+		}
+		if event.PPS > 0 {
+			event.ETA = float64(total-n) / event.PPS
+		}
+		encoder.Encode(event)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			emit()
+		case <-stop:
+			emit()
+			return
+		}
+	}
+}
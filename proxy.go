@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+func init() {
+	proxy.RegisterDialerType("http", newHTTPConnectDialer)
+}
+
+// proxyURL 为 -proxy 解析后的代理地址，为 nil 时直接连接目标
+var proxyURL *url.URL
+
+func parseProxy(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "socks5", "socks5h", "http":
+	default:
+		return nil, fmt.Errorf("不支持的代理协议: %s", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("代理地址缺少主机: %s", raw)
+	}
+	return u, nil
+}
+
+// localDialer 从本机发起TCP连接，遵循 -source、-netns 和 -vrf 设置
+type localDialer struct {
+	src string
+}
+
+func (d localDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+func (d localDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	nd := net.Dialer{Control: socketControl}
+	if d.src != "" {
+		nd.LocalAddr = &net.TCPAddr{IP: net.ParseIP(d.src)}
+	}
+
+	var conn net.Conn
+	err := withNetns(*netns, func() error {
+		var err error
+		conn, err = nd.DialContext(ctx, network, addr)
+		return err
+	})
+	return conn, err
+}
+
+// dialTarget 连接到目标地址，配置了 -proxy 时经由代理建立隧道
+func dialTarget(ctx context.Context, src, addr string) (net.Conn, error) {
+	direct := localDialer{src}
+	if proxyURL == nil {
+		return direct.DialContext(ctx, "tcp", addr)
+	}
+
+	d, err := proxy.FromURL(proxyURL, direct)
+	if err != nil {
+		return nil, err
+	}
+	if cd, ok := d.(proxy.ContextDialer); ok {
+		return cd.DialContext(ctx, "tcp", addr)
+	}
+	return d.Dial("tcp", addr)
+}
+
+// httpConnectDialer 通过 HTTP CONNECT 方法建立到目标的隧道
+type httpConnectDialer struct {
+	proxy   *url.URL
+	forward proxy.Dialer
+}
+
+func newHTTPConnectDialer(u *url.URL, forward proxy.Dialer) (proxy.Dialer, error) {
+	return &httpConnectDialer{proxy: u, forward: forward}, nil
+}
+
+func (d *httpConnectDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+func (d *httpConnectDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	var conn net.Conn
+	var err error
+	if cd, ok := d.forward.(proxy.ContextDialer); ok {
+		conn, err = cd.DialContext(ctx, "tcp", d.proxy.Host)
+	} else {
+		conn, err = d.forward.Dial("tcp", d.proxy.Host)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if user := d.proxy.User; user != nil {
+		password, _ := user.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("发送CONNECT请求失败: %v", err)
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("读取CONNECT响应失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("代理拒绝连接: %s", resp.Status)
+	}
+
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
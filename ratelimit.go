@@ -0,0 +1,60 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rateLimiter 将调用 wait 的频率限制在每秒 pps 次，pps 不大于0时不限速。扫描过程中可通过 set 调整
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval atomic.Int64 // 相邻两次调用的最小间隔(纳秒)
+	next     time.Time
+}
+
+func newRateLimiter(pps float64) *rateLimiter {
+	l := &rateLimiter{}
+	l.set(pps)
+	return l
+}
+
+// set 修改限速，pps 不大于0时取消限速。已在等待的调用仍按原来的间隔等待
+func (l *rateLimiter) set(pps float64) {
+	l.mu.Lock()
+	l.next = time.Time{}
+	l.mu.Unlock()
+	if pps <= 0 {
+		l.interval.Store(0)
+		return
+	}
+	l.interval.Store(int64(float64(time.Second) / pps))
+}
+
+// rate 返回当前每秒的次数，不限速时为0
+func (l *rateLimiter) rate() float64 {
+	if interval := l.interval.Load(); interval > 0 {
+		return float64(time.Second) / float64(interval)
+	}
+	return 0
+}
+
+func (l *rateLimiter) wait() {
+	interval := time.Duration(l.interval.Load())
+	if interval == 0 {
+		return
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(interval)
+	l.mu.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
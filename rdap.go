@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rdapNetwork 为 RDAP IP 网络对象中用到的字段
+type rdapNetwork struct {
+	StartAddress string       `json:"startAddress"`
+	EndAddress   string       `json:"endAddress"`
+	Name         string       `json:"name"`
+	Entities     []rdapEntity `json:"entities"`
+}
+
+type rdapEntity struct {
+	Roles      []string        `json:"roles"`
+	VCardArray json.RawMessage `json:"vcardArray"`
+	Entities   []rdapEntity    `json:"entities"`
+}
+
+// rdapInfo 为缓存的查询结果，覆盖 start 到 end 之间的全部地址
+type rdapInfo struct {
+	start, end netip.Addr
+	netname    string
+	abuse      string
+}
+
+// rdapClient 按网络范围缓存查询结果，并限制向 RDAP 服务发起请求的速率
+type rdapClient struct {
+	mu       sync.Mutex
+	cache    []rdapInfo
+	interval time.Duration
+	last     time.Time
+	client   *http.Client
+}
+
+func newRDAPClient(rate float64) *rdapClient {
+	c := &rdapClient{client: &http.Client{Timeout: 10 * time.Second}}
+	if rate > 0 {
+		c.interval = time.Duration(float64(time.Second) / rate)
+	}
+	return c
+}
+
+// lookup 返回IP所属网络的名称和滥用联系方式，同一网络范围内的IP只查询一次
+func (c *rdapClient) lookup(ip string) (netname, abuse string, err error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, info := range c.cache {
+		if info.start.Compare(addr) <= 0 && addr.Compare(info.end) <= 0 {
+			return info.netname, info.abuse, nil
+		}
+	}
+
+	network, err := c.fetch(ip)
+	if err != nil {
+		return "", "", err
+	}
+
+	info := rdapInfo{netname: network.Name, abuse: findAbuse(network.Entities)}
+	info.start, err = netip.ParseAddr(network.StartAddress)
+	if err == nil {
+		info.end, err = netip.ParseAddr(network.EndAddress)
+	}
+	if err != nil {
+		// 响应中没有有效的范围时只缓存该IP本身
+		info.start, info.end = addr, addr
+	}
+	c.cache = append(c.cache, info)
+
+	return info.netname, info.abuse, nil
+}
+
+func (c *rdapClient) fetch(ip string) (*rdapNetwork, error) {
+	for attempt := 0; ; attempt++ {
+		if wait := c.interval - time.Since(c.last); wait > 0 {
+			time.Sleep(wait)
+		}
+		c.last = time.Now()
+
+		req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(*rdapServer, "/")+"/ip/"+ip, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/rdap+json")
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < 3 {
+			resp.Body.Close()
+			retry, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+			time.Sleep(time.Duration(max(retry, 1)) * time.Second)
+			continue
+		}
+
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("RDAP服务返回 %s", resp.Status)
+		}
+
+		var network rdapNetwork
+		if err := json.NewDecoder(resp.Body).Decode(&network); err != nil {
+			return nil, fmt.Errorf("解析RDAP响应失败: %v", err)
+		}
+		return &network, nil
+	}
+}
+
+// findAbuse 在实体树中查找 abuse 角色的联系邮箱，没有邮箱时返回其名称
+func findAbuse(entities []rdapEntity) string {
+	for _, e := range entities {
+		for _, role := range e.Roles {
+			if role == "abuse" {
+				if contact := vcardContact(e.VCardArray); contact != "" {
+					return contact
+				}
+			}
+		}
+		if contact := findAbuse(e.Entities); contact != "" {
+			return contact
+		}
+	}
+	return ""
+}
+
+// vcardContact 从 jCard 格式的 ["vcard", [[name, params, type, value], ...]] 中提取 email 或 fn
+func vcardContact(raw json.RawMessage) string {
+	var card []json.RawMessage
+	if json.Unmarshal(raw, &card) != nil || len(card) < 2 {
+		return ""
+	}
+	var props [][]any
+	if json.Unmarshal(card[1], &props) != nil {
+		return ""
+	}
+
+	var fn string
+	for _, prop := range props {
+		if len(prop) < 4 {
+			continue
+		}
+		name, _ := prop[0].(string)
+		value, _ := prop[3].(string)
+		switch name {
+		case "email":
+			return value
+		case "fn":
+			fn = value
+		}
+	}
+	return fn
+}
+
+// enrichRDAP 为每个结果追加网络名称和滥用联系方式两列
+func enrichRDAP(results []result) {
+	client := newRDAPClient(*rdapRate)
+	for i := range results {
+		netname, abuse, err := client.lookup(results[i].ip)
+		if err != nil {
+			slog.Warn("查询RDAP信息失败", "ip", results[i].ip, "err", err)
+		}
+		results[i].extra = append(results[i].extra, netname, abuse)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redisSink 将每个结果写入Redis: 每个IP一个哈希 <prefix>:ip:<IP>，
+// 并维护按延迟(毫秒)排序的有序集合 <prefix>:latency。
+// 扫描过程中有序集合写入临时键，结束时整体替换，使有序集合只包含本次扫描有响应的IP
+type redisSink struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	w      *bufio.Writer
+	prefix string
+	ttl    time.Duration
+	count  int
+}
+
+// newRedisSink 连接地址形如 redis://:password@127.0.0.1:6379/0 的Redis服务器
+func newRedisSink(rawURL, prefix string, ttl time.Duration) (*redisSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "redis" || u.Host == "" {
+		return nil, fmt.Errorf("无效的Redis地址: %s", rawURL)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "6379")
+	}
+
+	conn, err := net.DialTimeout("tcp", host, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("无法连接Redis服务器: %v", err)
+	}
+	rs := &redisSink{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn), prefix: prefix, ttl: ttl}
+
+	var setup [][]string
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			if name := u.User.Username(); name != "" {
+				setup = append(setup, []string{"AUTH", name, pass})
+			} else {
+				setup = append(setup, []string{"AUTH", pass})
+			}
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if _, err := strconv.Atoi(db); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("无效的Redis数据库编号: %s", db)
+		}
+		setup = append(setup, []string{"SELECT", db})
+	}
+	setup = append(setup, []string{"DEL", rs.stagingKey()})
+	if err := rs.do(setup...); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return rs, nil
+}
+
+func (rs *redisSink) stagingKey() string {
+	return rs.prefix + ":latency:scanning"
+}
+
+func (rs *redisSink) send(res result, columns []string) error {
+	ms := strconv.FormatFloat(float64(res.duration)/1e6, 'f', -1, 64)
+	key := rs.prefix + ":ip:" + res.ip
+
+	hset := []string{"HSET", key, "latency_ms", ms, "updated", strconv.FormatInt(time.Now().Unix(), 10)}
+	for i, col := range columns {
+		hset = append(hset, headerName(col), res.extra[i])
+	}
+	cmds := [][]string{
+		{"DEL", key},
+		hset,
+		{"ZADD", rs.stagingKey(), ms, res.ip},
+	}
+	if rs.ttl > 0 {
+		cmds = append(cmds, []string{"EXPIRE", key, strconv.Itoa(int(rs.ttl.Seconds()))})
+	}
+
+	rs.count++
+	return rs.do(cmds...)
+}
+
+// close 用本次扫描的有序集合替换 <prefix>:latency 并断开连接
+func (rs *redisSink) close() error {
+	defer rs.conn.Close()
+
+	final := rs.prefix + ":latency"
+	if rs.count == 0 {
+		return rs.do([]string{"DEL", final})
+	}
+	cmds := [][]string{{"RENAME", rs.stagingKey(), final}}
+	if rs.ttl > 0 {
+		cmds = append(cmds, []string{"EXPIRE", final, strconv.Itoa(int(rs.ttl.Seconds()))})
+	}
+	return rs.do(cmds...)
+}
+
+// do 以流水线方式发送命令并读取全部应答，返回第一个错误应答
+func (rs *redisSink) do(cmds ...[]string) error {
+	rs.conn.SetDeadline(time.Now().Add(10 * time.Second))
+	for _, args := range cmds {
+		fmt.Fprintf(rs.w, "*%d\r\n", len(args))
+		for _, arg := range args {
+			fmt.Fprintf(rs.w, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if err := rs.w.Flush(); err != nil {
+		return fmt.Errorf("写入Redis失败: %v", err)
+	}
+
+	var first error
+	for _, args := range cmds {
+		if err := rs.readReply(); err != nil && first == nil {
+			first = fmt.Errorf("Redis命令 %s 失败: %v", args[0], err)
+		}
+	}
+	return first
+}
+
+// readReply 读取并丢弃一个RESP应答，错误应答转为 error
+func (rs *redisSink) readReply() error {
+	line, err := rs.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return fmt.Errorf("无效的应答")
+	}
+
+	switch line[0] {
+	case '-':
+		return fmt.Errorf("%s", line[1:])
+	case '+', ':':
+		return nil
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return fmt.Errorf("无效的应答: %s", line)
+		}
+		if n >= 0 {
+			_, err = rs.r.Discard(n + 2)
+		}
+		return err
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return fmt.Errorf("无效的应答: %s", line)
+		}
+		for i := 0; i < n; i++ {
+			if err := rs.readReply(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("无效的应答: %s", line)
+}
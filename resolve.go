@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// resolvers 为 -resolver 支持的主机名解析方式
+var resolvers = map[string]func(name string) ([]net.IP, error){
+	"system": net.LookupIP,
+	"dns":    lookupDNS,
+	"hosts":  lookupHostsFile,
+}
+
+// 解析时使用的系统文件
+const (
+	resolvConfPath = "/etc/resolv.conf"
+	hostsFilePath  = "/etc/hosts"
+)
+
+// lookupHost 按 -resolver 把主机名解析为其全部地址
+func lookupHost(name string) ([]net.IP, error) {
+	return resolvers[*resolver](name)
+}
+
+// resolveAddr 在开始计时前按 -resolver 把主机名目标解析为其第一个地址，使探测的延迟不包含解析时间，地址目标原样返回
+func resolveAddr(ip string) (string, error) {
+	if isAddress(ip) {
+		return ip, nil
+	}
+	var addrs []net.IP
+	err := withNetns(*netns, func() error {
+		var err error
+		addrs, err = lookupHost(ip)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("解析主机名失败: %v", err)
+	}
+	if len(addrs) == 0 {
+		return "", fmt.Errorf("解析主机名失败: %s 没有地址", ip)
+	}
+	return addrs[0].String(), nil
+}
+
+// resolveDuration 单独测量一次解析主机名目标的耗时，作为 -resolve-time 列的值，地址目标或解析失败时为空
+func resolveDuration(ip string) string {
+	if isAddress(ip) {
+		return ""
+	}
+	start := time.Now()
+	if _, err := resolveAddr(ip); err != nil {
+		slog.Debug("测量解析耗时失败", "host", ip, "err", err)
+		return ""
+	}
+	return formatValue(time.Since(start))
+}
+
+// lookupDNS 绕过 /etc/hosts，直接向 /etc/resolv.conf 中的DNS服务器查询A和AAAA记录，
+// 用于重新评估hosts文件中已固定的地址
+func lookupDNS(name string) ([]net.IP, error) {
+	conf, err := dns.ClientConfigFromFile(resolvConfPath)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取 %s: %v", resolvConfPath, err)
+	}
+	if len(conf.Servers) == 0 {
+		return nil, fmt.Errorf("%s 中没有DNS服务器", resolvConfPath)
+	}
+
+	var lastErr error
+	for _, fqdn := range conf.NameList(name) {
+		var ips []net.IP
+		for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			answers, err := queryServers(conf, fqdn, qtype)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			for _, rr := range answers {
+				switch rr := rr.(type) {
+				case *dns.A:
+					ips = append(ips, rr.A)
+				case *dns.AAAA:
+					ips = append(ips, rr.AAAA)
+				}
+			}
+		}
+		if len(ips) > 0 {
+			return ips, nil
+		}
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, fmt.Errorf("DNS中没有 %s 的地址记录", name)
+}
+
+// queryServers 依次向各个服务器发送递归查询直到有一个应答，截断的应答改用TCP重新查询
+func queryServers(conf *dns.ClientConfig, fqdn string, qtype uint16) ([]dns.RR, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(fqdn, qtype)
+	timeout := time.Duration(max(conf.Timeout, 1)) * time.Second
+
+	var lastErr error
+	for _, server := range conf.Servers {
+		addr := net.JoinHostPort(server, conf.Port)
+		reply, _, err := (&dns.Client{Timeout: timeout}).Exchange(m, addr)
+		if err == nil && reply.Truncated {
+			reply, _, err = (&dns.Client{Net: "tcp", Timeout: timeout}).Exchange(m, addr)
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if reply.Rcode != dns.RcodeSuccess && reply.Rcode != dns.RcodeNameError {
+			lastErr = fmt.Errorf("%s 返回 %s", server, dns.RcodeToString[reply.Rcode])
+			continue
+		}
+		return reply.Answer, nil
+	}
+	return nil, lastErr
+}
+
+// hostsEntries 在首次使用时读取 /etc/hosts，键为小写的主机名
+var hostsEntries = sync.OnceValues(func() (map[string][]net.IP, error) {
+	file, err := os.Open(hostsFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := make(map[string][]net.IP)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		ip := net.ParseIP(fields[0])
+		if ip == nil {
+			continue
+		}
+		for _, name := range fields[1:] {
+			name = strings.ToLower(strings.TrimSuffix(name, "."))
+			entries[name] = append(entries[name], ip)
+		}
+	}
+	return entries, scanner.Err()
+})
+
+// lookupHostsFile 只从 /etc/hosts 中查找主机名，不查询DNS
+func lookupHostsFile(name string) ([]net.IP, error) {
+	entries, err := hostsEntries()
+	if err != nil {
+		return nil, fmt.Errorf("无法读取 %s: %v", hostsFilePath, err)
+	}
+	ips, ok := entries[strings.ToLower(strings.TrimSuffix(name, "."))]
+	if !ok {
+		return nil, fmt.Errorf("%s 中没有 %s", hostsFilePath, name)
+	}
+	return ips, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// echoIgnorePaths 为Linux上关闭内核回显应答的开关，开启时只有 respond 子命令应答回显请求
+var echoIgnorePaths = map[bool]string{
+	false: "/proc/sys/net/ipv4/icmp_echo_ignore_all",
+	true:  "/proc/sys/net/ipv6/icmp/echo_ignore_all",
+}
+
+// responder 按配置的延迟和丢包应答回显请求，rng 在多个协程间共享，使用前须加锁
+type responder struct {
+	conn   net.PacketConn
+	proto  int
+	v6     bool
+	delay  time.Duration
+	jitter time.Duration
+	loss   float64
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// runRespond 实现 respond 子命令: 在原始套接字上应答ICMP回显请求，可注入固定延迟、随机抖动和丢包，
+// 作为可控的对端在CI和实验环境中测试扫描的超时处理和丢包统计。-seed 相同时丢包和抖动的序列相同
+func runRespond(args []string) {
+	listenAddr := flag.String("listen", "0.0.0.0", "接收回显请求的本机地址，IPv6 如 ::")
+	delay := flag.Duration("delay", 0, "每个应答的固定延迟")
+	jitter := flag.Duration("jitter", 0, "在固定延迟之上随机增加的最大延迟")
+	loss := flag.Float64("loss", 0, "随机丢弃的回显请求的比例(%)")
+	flag.CommandLine.Parse(args)
+
+	if err := setupLogging(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	if *delay < 0 || *jitter < 0 || *loss < 0 || *loss > 100 {
+		slog.Error("-delay 和 -jitter 不能小于0，-loss 须在 0 到 100 之间")
+		return
+	}
+
+	v6 := strings.Contains(*listenAddr, ":")
+	network, proto := "ip4:icmp", 1
+	if v6 {
+		network, proto = "ip6:ipv6-icmp", 58
+	}
+	conn, err := listen(network, *listenAddr)
+	if err != nil {
+		slog.Error("创建ICMP连接失败", "err", err)
+		return
+	}
+	defer conn.Close()
+
+	// 内核仍会应答时扫描收到的是内核的应答，注入的延迟和丢包不会生效
+	if b, err := os.ReadFile(echoIgnorePaths[v6]); err == nil && strings.TrimSpace(string(b)) == "0" {
+		slog.Warn("内核仍在应答回显请求，注入的延迟和丢包不会生效，请先关闭", "sysctl", strings.ReplaceAll(strings.TrimPrefix(echoIgnorePaths[v6], "/proc/sys/"), "/", "."))
+	}
+
+	r := &responder{conn: conn, proto: proto, v6: v6, delay: *delay, jitter: *jitter, loss: *loss / 100, rng: seededRand()}
+	slog.Info("正在应答回显请求", "listen", *listenAddr, "delay", *delay, "jitter", *jitter, "loss", *loss)
+	if err := r.serve(); err != nil {
+		slog.Error(err.Error())
+	}
+}
+
+// serve 持续读取回显请求，按丢包比例决定是否应答，应答在延迟之后发出
+func (r *responder) serve() error {
+	buf := make([]byte, 65535)
+	for {
+		n, peer, err := r.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("读取ICMP套接字失败: %v", err)
+		}
+		m, err := icmp.ParseMessage(r.proto, buf[:n])
+		if err != nil || (m.Type != ipv4.ICMPTypeEcho && m.Type != ipv6.ICMPTypeEchoRequest) {
+			continue
+		}
+		echo, ok := m.Body.(*icmp.Echo)
+		if !ok {
+			continue
+		}
+
+		r.mu.Lock()
+		drop := r.rng.Float64() < r.loss
+		wait := r.delay
+		if r.jitter > 0 {
+			wait += time.Duration(r.rng.Int63n(int64(r.jitter) + 1))
+		}
+		r.mu.Unlock()
+		if drop {
+			slog.Debug("丢弃回显请求", "peer", peer, "id", echo.ID, "seq", echo.Seq)
+			continue
+		}
+
+		var replyType icmp.Type = ipv4.ICMPTypeEchoReply
+		if r.v6 {
+			replyType = ipv6.ICMPTypeEchoReply
+		}
+		reply := icmp.Message{
+			Type: replyType,
+			Body: &icmp.Echo{ID: echo.ID, Seq: echo.Seq, Data: append([]byte(nil), echo.Data...)},
+		}
+		// ICMPv6 的校验和由内核计算
+		wb, err := reply.Marshal(nil)
+		if err != nil {
+			continue
+		}
+		time.AfterFunc(wait, func() {
+			if _, err := r.conn.WriteTo(wb, peer); err != nil {
+				slog.Debug("发送回显应答失败", "peer", peer, "err", err)
+			}
+		})
+	}
+}
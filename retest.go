@@ -0,0 +1,94 @@
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// retestSet 保存本次扫描中各个有响应目标第一轮探测的原始数据，复测时与复测的探测合并为新的结果
+type retestSet struct {
+	mu      sync.Mutex
+	entries map[string]retestEntry
+}
+
+type retestEntry struct {
+	t      target
+	src    string
+	rtts   []time.Duration // 未经开销校准修正的延迟
+	sent   int
+	values []string
+}
+
+// retestEnabled 判断是否设置了 -retest-near 或 -retest-noisy
+func retestEnabled() bool {
+	return *retestNear > 0 || *retestNoisy
+}
+
+func (r *retestSet) remember(t target, src string, rtts []time.Duration, sent int, values []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[t.ip] = retestEntry{t: t, src: src, rtts: slices.Clone(rtts), sent: sent, values: values}
+}
+
+// borderline 判断结果是否需要复测: 平均延迟与 -retest-near 相差不超过 -retest-margin，
+// 或设置了 -retest-noisy 且多次探测中有丢包或抖动超过平均延迟的 -retest-margin
+func borderline(res result) bool {
+	margin := *retestMargin / 100
+	if *retestNear > 0 {
+		diff := res.duration - *retestNear
+		if diff < 0 {
+			diff = -diff
+		}
+		if float64(diff) <= float64(*retestNear)*margin {
+			return true
+		}
+	}
+	if *retestNoisy && res.sent > 1 {
+		if len(res.rtts) < res.sent || float64(jitter(res.rtts)) > float64(res.duration)*margin {
+			return true
+		}
+	}
+	return false
+}
+
+// retest 在第一轮扫描结束后再次探测处于边缘的结果，把两轮的探测合并后替换原来的结果，
+// 复测中全部失败的探测计入丢包。复用缓存的结果不复测，实时推送的仍为第一轮的结果
+func (s *scanner) retest(results []result) {
+	r := s.retests
+	s.retests = nil
+	var picked []int
+	for i, res := range results {
+		if _, ok := r.entries[res.ip]; ok && borderline(res) {
+			picked = append(picked, i)
+		}
+	}
+	if len(picked) == 0 {
+		return
+	}
+
+	slog.Info("正在复测处于边缘的目标", "targets", len(picked))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(max(*maxThreads, 1), len(picked)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				e := r.entries[results[i].ip]
+				s.limiter.wait()
+				rtts, sent, _, _ := s.measure(e.t, e.src)
+				merged := append(slices.Clone(e.rtts), rtts...)
+				results[i] = s.newResult(e.t, e.src, merged, e.sent+sent, e.values)
+				slog.Debug("复测结果", "ip", results[i].ip, "latency", results[i].latency, "received", len(merged), "sent", e.sent+sent)
+			}
+		}()
+	}
+	for _, i := range picked {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	slog.Info("复测完成", "targets", len(picked))
+}
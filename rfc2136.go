@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func validateRFC2136() error {
+	if *dnsServer == "" {
+		return fmt.Errorf("rfc2136 需要用 -dns-server 指定接受动态更新的权威服务器")
+	}
+	if (os.Getenv("ICMP_SCAN_TSIG_KEY") == "") != (os.Getenv("ICMP_SCAN_TSIG_SECRET") == "") {
+		return fmt.Errorf("环境变量 ICMP_SCAN_TSIG_KEY 和 ICMP_SCAN_TSIG_SECRET 需要同时设置")
+	}
+	return nil
+}
+
+// rfc2136Zone 返回记录所在的区域: -dns-zone 指定的区域，未指定时从记录名开始逐级向上向 -dns-server 查询SOA，
+// 第一个有SOA记录的名称即为区域
+func rfc2136Zone(c *dns.Client, server, name string) (string, error) {
+	if *dnsZone != "" {
+		return *dnsZone, nil
+	}
+	labels := strings.Split(name, ".")
+	for i := 0; i < len(labels)-1; i++ {
+		candidate := dns.Fqdn(strings.Join(labels[i:], "."))
+		q := new(dns.Msg)
+		q.SetQuestion(candidate, dns.TypeSOA)
+		r, _, err := c.Exchange(q, server)
+		if err != nil {
+			return "", err
+		}
+		for _, rr := range r.Answer {
+			if soa, ok := rr.(*dns.SOA); ok && strings.EqualFold(soa.Hdr.Name, candidate) {
+				return candidate, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("找不到记录 %s 所属的区域，可用 -dns-zone 指定", name)
+}
+
+// updateRFC2136 向 -dns-server 发送一个 RFC 2136 动态更新，先删除记录原有的每种类型再插入新地址。
+// 设置了 ICMP_SCAN_TSIG_KEY/ICMP_SCAN_TSIG_SECRET 时使用 TSIG 签名，算法由 ICMP_SCAN_TSIG_ALGORITHM 指定，默认 hmac-sha256
+func updateRFC2136(name string, records map[string][]string) error {
+	c := &dns.Client{Timeout: 10 * time.Second}
+	server := *dnsServer
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	zone, err := rfc2136Zone(c, server, name)
+	if err != nil {
+		return err
+	}
+
+	m := new(dns.Msg)
+	m.SetUpdate(dns.Fqdn(zone))
+	fqdn := dns.Fqdn(name)
+	for _, typ := range recordTypes(records) {
+		rrtype := dns.StringToType[typ]
+		m.RemoveRRset([]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: fqdn, Rrtype: rrtype, Class: dns.ClassINET}}})
+		var rrs []dns.RR
+		for _, ip := range records[typ] {
+			hdr := dns.RR_Header{Name: fqdn, Rrtype: rrtype, Class: dns.ClassINET, Ttl: uint32(*dnsTTL)}
+			if rrtype == dns.TypeA {
+				rrs = append(rrs, &dns.A{Hdr: hdr, A: net.ParseIP(ip)})
+			} else {
+				rrs = append(rrs, &dns.AAAA{Hdr: hdr, AAAA: net.ParseIP(ip)})
+			}
+		}
+		m.Insert(rrs)
+	}
+
+	if key := os.Getenv("ICMP_SCAN_TSIG_KEY"); key != "" {
+		algorithm := os.Getenv("ICMP_SCAN_TSIG_ALGORITHM")
+		if algorithm == "" {
+			algorithm = "hmac-sha256"
+		}
+		m.SetTsig(dns.Fqdn(key), dns.Fqdn(algorithm), 300, time.Now().Unix())
+		c.TsigSecret = map[string]string{dns.Fqdn(key): os.Getenv("ICMP_SCAN_TSIG_SECRET")}
+	}
+
+	r, _, err := c.Exchange(m, server)
+	if err != nil {
+		return err
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("服务器拒绝了更新: %s", dns.RcodeToString[r.Rcode])
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// route53Request 为 ChangeResourceRecordSets 的请求体
+type route53Request struct {
+	XMLName xml.Name        `xml:"https://route53.amazonaws.com/doc/2013-04-01/ ChangeResourceRecordSetsRequest"`
+	Comment string          `xml:"ChangeBatch>Comment"`
+	Changes []route53Change `xml:"ChangeBatch>Changes>Change"`
+}
+
+type route53Change struct {
+	Action string         `xml:"Action"`
+	Name   string         `xml:"ResourceRecordSet>Name"`
+	Type   string         `xml:"ResourceRecordSet>Type"`
+	TTL    int            `xml:"ResourceRecordSet>TTL"`
+	Values []route53Value `xml:"ResourceRecordSet>ResourceRecords>ResourceRecord"`
+}
+
+type route53Value struct {
+	Value string `xml:"Value"`
+}
+
+func validateRoute53() error {
+	if *dnsZone == "" {
+		return fmt.Errorf("route53 需要用 -dns-zone 指定托管区域ID")
+	}
+	// 凭据链在所有来源都失败时返回匿名凭据而不是错误
+	creds, err := awsCredentials().Get()
+	if err != nil {
+		return fmt.Errorf("无法获取AWS凭据: %v", err)
+	}
+	if creds.AccessKeyID == "" {
+		return fmt.Errorf("没有找到AWS凭据，请设置 AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY 或 ~/.aws/credentials")
+	}
+	return nil
+}
+
+// updateRoute53 以一次 UPSERT 批量替换记录的每种类型
+func updateRoute53(name string, records map[string][]string) error {
+	body := route53Request{Comment: "icmp-scan"}
+	for _, typ := range recordTypes(records) {
+		change := route53Change{Action: "UPSERT", Name: name + ".", Type: typ, TTL: *dnsTTL}
+		for _, ip := range records[typ] {
+			change.Values = append(change.Values, route53Value{ip})
+		}
+		body.Changes = append(body.Changes, change)
+	}
+	payload, err := xml.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	endpoint := "https://route53.amazonaws.com"
+	if *dnsEndpoint != "" {
+		endpoint = strings.TrimSuffix(*dnsEndpoint, "/")
+	}
+	zone := strings.TrimPrefix(*dnsZone, "/hostedzone/")
+	req, err := http.NewRequest("POST", endpoint+"/2013-04-01/hostedzone/"+zone+"/rrset", bytes.NewReader(append([]byte(xml.Header), payload...)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/xml")
+	if err := signAWSv4(req, "route53", "us-east-1"); err != nil {
+		return err
+	}
+
+	resp, err := dnsClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Code    string `xml:"Error>Code"`
+			Message string `xml:"Error>Message"`
+		}
+		b, _ := io.ReadAll(resp.Body)
+		if xml.Unmarshal(b, &apiErr) == nil && apiErr.Code != "" {
+			return fmt.Errorf("Route53 返回错误 (HTTP %d): %s %s", resp.StatusCode, apiErr.Code, apiErr.Message)
+		}
+		return fmt.Errorf("Route53 返回错误: HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// signAWSv4 按 AWS Signature Version 4 为请求签名，签名覆盖 host、x-amz-date 和 x-amz-security-token 头部
+func signAWSv4(req *http.Request, service, region string) error {
+	creds, err := awsCredentials().Get()
+	if err != nil {
+		return fmt.Errorf("无法获取AWS凭据: %v", err)
+	}
+
+	var payload []byte
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+		payload, err = io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+	}
+	payloadHash := sha256.Sum256(payload)
+
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	headers := []string{"host:" + req.URL.Host, "x-amz-date:" + amzDate}
+	signed := "host;x-amz-date"
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+		headers = append(headers, "x-amz-security-token:"+creds.SessionToken)
+		signed += ";x-amz-security-token"
+	}
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		strings.Join(headers, "\n") + "\n",
+		signed,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	mac := func(key []byte, data string) []byte {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(data))
+		return h.Sum(nil)
+	}
+	key := mac([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = mac(key, region)
+	key = mac(key, service)
+	key = mac(key, "aws4_request")
+	signature := hex.EncodeToString(mac(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signed, signature))
+	return nil
+}
@@ -0,0 +1,593 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// scanner 保存一次扫描所需的探测方式和源地址配置，可重复用于多轮扫描。
+// columns 为结果中 IP 和延迟之后的附加列，与 result.extra 一一对应
+type scanner struct {
+	probe    probeFunc
+	columns  []string
+	pool     *sourcePool
+	clouds   *cloudIndex
+	probed   int64 // 最近一次扫描实际探测的目标数，扫描中断时小于目标总数
+	sinks    []resultSink
+	overhead time.Duration // 开启 -subtract-overhead 时从每次探测的延迟中减去的本机开销
+	throttle *throttle     // 开启 -adaptive 时每次扫描重新创建
+	limited  []string      // 最近一次扫描中因疑似限速而未能确认存活的目标
+	limiter  *rateLimiter  // -rate 限速器，同一目标的多次探测 (-count) 也按其限速
+	score    *expression   // 设置了 -score 或 -weights 时按得分排序结果
+	order    []sortKey     // 设置了 -sort 时最后按这些键排序结果
+	late     bool          // 多次ICMP探测 (-count) 时输出每个目标的迟到应答数
+	cache    *resultCache  // -cache 结果缓存，在 ttl 内成功探测过的目标直接复用缓存的结果
+	labels   int           // 输入文件中的标签列数，即 columns 开头的标签列
+	gate     *pauseGate    // 暂停时工作协程不再发起新的探测
+	feed     *targetFeed   // 设置了 -control 时接受扫描过程中追加的目标
+	retests  *retestSet    // 设置了 -retest-near 或 -retest-noisy 时记录第一轮的探测，每次扫描重新创建
+
+	// 正在进行的扫描的进度和已收到的结果，供 -control 查询
+	mu        sync.Mutex
+	collected []result
+	done      atomic.Int64
+	total     atomic.Int64
+	// halted 在 halt 后关闭，扫描不再派发新的目标；skipped 为因此未探测的目标，不计入无响应的目标
+	halted  chan struct{}
+	skipped map[string]bool
+	// signature 由探测参数和探测阶段产生的附加列组成，缓存只复用签名相同的结果
+	signature string
+}
+
+// newScanner 根据命令行参数校验探测方式、代理和源地址
+func newScanner() (*scanner, error) {
+	if err := applyProfile(); err != nil {
+		return nil, err
+	}
+	pm, ok := probes[*mode]
+	if !ok {
+		return nil, fmt.Errorf("未知的探测方式: %s", *mode)
+	}
+	if _, ok := latencyUnits[*unit]; !ok {
+		return nil, fmt.Errorf("未知的延迟单位: %s，可用的单位: us、ms 或 s", *unit)
+	}
+	if err := validateHeaders(); err != nil {
+		return nil, err
+	}
+	if *port == 0 {
+		*port = pm.port
+	}
+
+	if *expectStatus != "" || *expectBody != "" {
+		if *mode != "http" {
+			return nil, fmt.Errorf("响应校验仅支持 -mode http")
+		}
+		var err error
+		check, err = parseHTTPCheck(*expectStatus, *expectBody)
+		if err != nil {
+			return nil, fmt.Errorf("无法解析响应校验规则: %v", err)
+		}
+	}
+
+	if *proxyAddr != "" {
+		if *mode != "tcp" && *mode != "http" {
+			return nil, fmt.Errorf("%s 探测不支持代理，请使用 -mode tcp 或 -mode http", strings.ToUpper(*mode))
+		}
+		var err error
+		proxyURL, err = parseProxy(*proxyAddr)
+		if err != nil {
+			return nil, fmt.Errorf("无法解析代理地址: %v", err)
+		}
+	}
+
+	if *tsNTP != "" {
+		if *mode != "timestamp" {
+			return nil, fmt.Errorf("-ts-ntp 仅用于 -mode timestamp")
+		}
+		offset, err := localClockOffset()
+		if err != nil {
+			return nil, fmt.Errorf("无法校正本机时钟: %v", err)
+		}
+		slog.Info("本机时钟偏差", "server", *tsNTP, "offset", offset)
+	}
+
+	if *adaptive && *mode != "icmp" {
+		return nil, fmt.Errorf("限速检测仅支持 -mode icmp")
+	}
+	if *icmpIdent < 0 || *icmpIdent > 0xffff {
+		return nil, fmt.Errorf("-icmp-id 必须在 1 到 65535 之间")
+	}
+	if *probeCount < 1 || *retries < 0 {
+		return nil, fmt.Errorf("-count 必须大于0，-retries 不能小于0")
+	}
+	if *stopAfter < 0 || *maxLatency < 0 {
+		return nil, fmt.Errorf("-stop-after 和 -max-latency 不能小于0")
+	}
+	if *leaderboard < 0 || *leaderboardN < 1 {
+		return nil, fmt.Errorf("-leaderboard 不能小于0，-leaderboard-n 必须大于0")
+	}
+	if *retestMargin < 0 {
+		return nil, fmt.Errorf("-retest-margin 不能小于0")
+	}
+	if err := validateSpeedURL(); err != nil {
+		return nil, err
+	}
+	score, err := parseScore(*scoreExpr, *weights)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := parseSort(*sortKeys)
+	if err != nil {
+		return nil, fmt.Errorf("无法解析 -sort: %v", err)
+	}
+	if tracer, err = parseTraceFilter(*debugProbes); err != nil {
+		return nil, err
+	}
+
+	s := &scanner{probe: pm.probe, limiter: newRateLimiter(*rate), score: score, order: order, gate: newPauseGate(), halted: make(chan struct{})}
+	if *calibration || *deductOverhead {
+		overhead, err := calibrate()
+		if err != nil {
+			return nil, err
+		}
+		if *deductOverhead {
+			s.overhead = overhead
+		}
+	}
+	if pm.columns != nil {
+		s.columns = pm.columns()
+	}
+	if *ipOption != "" {
+		column, err := validateIPOption()
+		if err != nil {
+			return nil, err
+		}
+		s.probe = optionPing
+		s.columns = append(s.columns, column)
+	}
+	if *flows > 0 {
+		if *mode != "icmp" || *ipOption != "" {
+			return nil, fmt.Errorf("-flows 仅支持 -mode icmp，且不能与 -ip-option 同时使用")
+		}
+		if *flows > maxFlows {
+			return nil, fmt.Errorf("-flows 不能超过 %d", maxFlows)
+		}
+		s.columns = append(s.columns, "有响应的流", unitColumn("流间延迟差"), "各流最低延迟")
+	}
+	if *resolveTime {
+		s.columns = append(s.columns, unitColumn("解析耗时"))
+	}
+	if *probeCount > 1 {
+		s.columns = append(s.columns, "丢包率", unitColumn("抖动"), unitColumn("P50延迟"), unitColumn("P90延迟"), unitColumn("P99延迟"))
+	}
+	if *sources != "" {
+		err := withNetns(*netns, func() error {
+			var err error
+			s.pool, err = newSourcePool(*sources, *shardMode)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("无法解析源地址: %v", err)
+		}
+		s.columns = append(s.columns, "源地址")
+	}
+	if *colo {
+		s.columns = append(s.columns, "数据中心")
+	}
+	s.signature = strings.Join([]string{*mode, strconv.Itoa(*port), *hostHeader, *query, *qtypeName,
+		strconv.FormatBool(*useTLS), strconv.FormatBool(*dnsTCP), *expectStatus, *expectBody, *proxyAddr,
+		*sources, strconv.Itoa(*probeCount), strconv.FormatBool(*warmup), strings.Join(s.columns, ",")}, "|")
+	if *probeCount > 1 && (*mode == "icmp" || *mode == "xecho") {
+		s.late = true
+		s.columns = append(s.columns, "迟到应答")
+	}
+	if *rdap {
+		s.columns = append(s.columns, "网络名称", "滥用联系")
+	}
+	if *cloud {
+		var err error
+		s.clouds, err = loadCloudIndex(*cloudRanges)
+		if err != nil {
+			return nil, err
+		}
+		s.columns = append(s.columns, "云服务商", "区域")
+	}
+	if *speedURL != "" {
+		s.columns = append(s.columns, "下载速度")
+	}
+	if s.score != nil {
+		s.columns = append(s.columns, "得分")
+	}
+
+	return s, nil
+}
+
+// run 并发探测所有目标，返回按延迟 (设置了 -score 或 -weights 时为得分) 升序排列的成功结果。
+// 设置了 -cache 时跳过缓存中仍有效的目标，其结果与本次探测的结果一同返回。通过 -control 追加的目标在输入的目标之后探测
+func (s *scanner) run(list []target) []result {
+	if s.feed != nil {
+		s.feed.begin(list)
+	}
+	var cached []result
+	if s.cache != nil {
+		var err error
+		if list, cached, err = s.cache.split(list); err != nil {
+			slog.Warn(err.Error())
+		} else if len(cached) > 0 {
+			slog.Info("已复用缓存的结果", "cached", len(cached), "probe", len(list))
+		}
+	}
+	s.mu.Lock()
+	s.halted, s.skipped = make(chan struct{}), make(map[string]bool)
+	s.mu.Unlock()
+	targets := make(chan target)
+	go func() {
+		if s.dispatch(targets, list) && s.feed != nil {
+			s.feed.drain(s, targets)
+		}
+		close(targets)
+	}()
+	results := s.stream(targets, int64(len(list)), cached)
+	s.probed += int64(len(cached))
+	return results
+}
+
+// dispatch 把 list 中的目标依次发送到 targets。扫描被停止时把其余的目标记为未探测、从总数中减去并返回 false
+func (s *scanner) dispatch(targets chan<- target, list []target) bool {
+	for i, t := range list {
+		select {
+		case targets <- t:
+		case <-s.halted:
+			s.mu.Lock()
+			for _, t := range list[i:] {
+				s.skipped[t.ip] = true
+			}
+			s.mu.Unlock()
+			s.total.Add(-int64(len(list) - i))
+			return false
+		}
+	}
+	return true
+}
+
+// halt 使当前扫描停止派发新的目标并解除暂停，已发出的探测照常完成，已收到的结果照常输出
+func (s *scanner) halt(reason string) {
+	s.mu.Lock()
+	select {
+	case <-s.halted:
+		s.mu.Unlock()
+		return
+	default:
+		close(s.halted)
+	}
+	s.mu.Unlock()
+	s.setPaused(false)
+	slog.Info("停止派发新的目标", "reason", reason, "done", s.done.Load())
+}
+
+// unprobed 从 targets 中去掉扫描停止后未探测的目标
+func (s *scanner) unprobed(targets []target) []target {
+	if len(s.skipped) == 0 {
+		return targets
+	}
+	return slices.DeleteFunc(targets, func(t target) bool { return s.skipped[t.ip] })
+}
+
+// job 为分发给工作协程的目标，index 为目标在输入中的序号，用于多源轮询分片
+type job struct {
+	t     target
+	index int
+}
+
+// stream 使用 -max 个工作协程探测从 targets 中读取的目标直到通道关闭，total 仅用于显示进度，追加目标时随之增加。
+// 设置了 -rate 时按每秒发起的探测数限速。cached 为无需探测的结果，与探测结果一同推送和返回
+func (s *scanner) stream(targets <-chan target, total int64, cached []result) []result {
+	resultChan := make(chan result, *maxThreads)
+	resultQueue.Store(&resultChan)
+	defer resultQueue.Store(nil)
+	s.throttle, s.limited = nil, nil
+	lateBefore := lateReplyCount.Value()
+	if *adaptive {
+		s.throttle = newThrottle()
+	}
+	if retestEnabled() {
+		s.retests = &retestSet{entries: make(map[string]retestEntry)}
+	}
+
+	s.mu.Lock()
+	s.collected = nil
+	s.mu.Unlock()
+	s.done.Store(0)
+	s.total.Store(total)
+
+	collected := make(chan struct{})
+	go func() {
+		good := 0
+		for res := range resultChan {
+			s.mu.Lock()
+			s.collected = append(s.collected, res)
+			s.mu.Unlock()
+			if *stopAfter > 0 && (*maxLatency == 0 || res.duration <= *maxLatency) {
+				if good++; good == *stopAfter {
+					s.halt("stop-after")
+				}
+			}
+			for _, sink := range s.sinks {
+				if err := sink.send(res, s.columns); err != nil {
+					slog.Warn("推送结果失败", "ip", res.ip, "err", err)
+				}
+			}
+		}
+		close(collected)
+	}()
+
+	stopProgress := func() {}
+	if *progress == "json" {
+		stop := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			reportProgress(&s.done, &s.total, time.Second, stop)
+			close(stopped)
+		}()
+		stopProgress = func() {
+			close(stop)
+			<-stopped
+		}
+	}
+
+	stopLeaderboard := func() {}
+	if *leaderboard > 0 {
+		stop := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			s.reportLeaderboard(*leaderboard, stop)
+			close(stopped)
+		}()
+		stopLeaderboard = func() {
+			close(stop)
+			<-stopped
+		}
+	}
+
+	jobs := make(chan job)
+	go func() {
+		i := 0
+		for t := range targets {
+			jobs <- job{t, i}
+			i++
+		}
+		close(jobs)
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < max(*maxThreads, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				// 暂停在限速之后检查，已在等待限速的协程也不会在暂停期间发出探测，
+				// 恢复后重新排队，使恢复后的速率仍不超过 -rate
+				for {
+					s.limiter.wait()
+					if !s.gate.isPaused() {
+						break
+					}
+					s.gate.wait()
+				}
+				if s.throttle != nil {
+					s.throttle.wait(j.t.ip)
+				}
+				probesInFlight.Add(1)
+				res, err := s.probeTarget(j.t, s.pool.pick(j.index, j.t.ip))
+				probesInFlight.Add(-1)
+				probesDone.Add(1)
+				if s.throttle != nil {
+					s.throttle.observe(j, err)
+				}
+				if err == nil {
+					probesOK.Add(1)
+					if s.cache != nil {
+						s.cache.put(j.t, res)
+					}
+					resultChan <- res
+				}
+
+				done := s.done.Add(1)
+				if *progress == "json" {
+					continue
+				}
+				total := s.total.Load()
+				percentage := float64(done) / float64(total) * 100
+				fmt.Printf("已完成: %d 总数: %d 已完成: %.2f%%\r", done, total, percentage)
+				if done == total {
+					fmt.Printf("已完成: %d 总数: %d 已完成: %.2f%%\n", done, total, percentage)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	stopProgress()
+	stopLeaderboard()
+	for _, res := range cached {
+		resultChan <- res
+	}
+	if s.throttle != nil {
+		for _, res := range s.retryThrottled() {
+			resultChan <- res
+		}
+	}
+	close(resultChan)
+	<-collected
+	s.probed = s.done.Load()
+	s.mu.Lock()
+	results := s.collected
+	s.mu.Unlock()
+	if s.retests != nil {
+		s.retest(results)
+	}
+	checkSocketDrops()
+	reportLateReplies(lateBefore)
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].duration < results[j].duration
+	})
+
+	s.enrich(results)
+	return results
+}
+
+// enrich 为整批结果补充扫描结束后才能确定的迟到应答数，以及需要批量查询的 RDAP、云服务商和下载速度列，设置了 -score 或 -weights 时按得分重新排序，
+// 设置了 -sort 时再按其排序键重新排序。
+// results 须已按延迟升序排列
+func (s *scanner) enrich(results []result) {
+	if s.late {
+		for i := range results {
+			results[i].extra = append(results[i].extra, strconv.Itoa(lateCount(results[i].ip)))
+		}
+	}
+	if *rdap && len(results) > 0 {
+		slog.Info("正在查询RDAP信息", "results", len(results))
+		enrichRDAP(results)
+	}
+	if s.clouds != nil {
+		enrichCloud(results, s.clouds)
+	}
+	if *speedURL != "" && len(results) > 0 {
+		enrichSpeed(results, s.pool)
+	}
+	if s.score != nil {
+		rankByScore(results, s.score)
+	}
+	if s.order != nil {
+		sortResults(results, s.order)
+	}
+}
+
+// probeTarget 对单个目标执行 -count 次探测并补充附加列，任一次成功即视为有响应。全部失败时再重试最多 -retries 次，
+// 重试也全部失败时返回最后一次失败的原因。探测方式的附加列取自第一次成功的探测。
+// 输入中为目标指定的 timeout、count 和 retries 优先于命令行参数
+func (s *scanner) probeTarget(t target, src string) (result, error) {
+	rtts, sent, values, err := s.measure(t, src)
+	if err != nil {
+		return result{}, err
+	}
+	if *resolveTime {
+		values = append(values, resolveDuration(t.ip))
+	}
+	if s.retests != nil {
+		s.retests.remember(t, src, rtts, sent, values)
+	}
+	res := s.newResult(t, src, rtts, sent, values)
+	slog.Debug("探测成功", "ip", t.ip, "mode", *mode, "latency", res.latency, "received", len(rtts), "sent", sent)
+	return res, nil
+}
+
+// measure 执行 probeTarget 中的各次探测，返回未经开销校准修正的各次成功的延迟、发出的探测数和探测方式的附加列。
+// 设置了 -warmup 时先发出一次不计入统计的预热探测。设置了 -flows 时每条流各探测 count 次，第 i 次探测属于第 i%flows 条流，
+// 附加列之后是各条流的统计。全部失败时返回最后一次失败的原因
+func (s *scanner) measure(t target, src string) ([]time.Duration, int, []string, error) {
+	ip := t.ip
+	count, attempts, timeout := *probeCount, *retries, *timeout
+	if t.opts.count > 0 {
+		count = t.opts.count
+	}
+	if t.opts.retries != nil {
+		attempts = *t.opts.retries
+	}
+	if t.opts.timeout > 0 {
+		timeout = t.opts.timeout
+	}
+	var (
+		rtts    []time.Duration
+		values  []string
+		lastErr error
+		best    []time.Duration
+		flowOK  []bool
+	)
+	if *flows > 0 {
+		count *= *flows
+		best, flowOK = make([]time.Duration, *flows), make([]bool, *flows)
+	}
+	// 局域网中第一次探测要等待ARP/ND解析，延迟明显偏高，预热探测的结果不计入统计
+	if *warmup {
+		if _, _, err := s.probe(ip, src, timeout); err != nil {
+			slog.Debug("预热探测失败", "ip", ip, "err", err)
+		}
+		s.limiter.wait()
+	}
+	sent := 0
+	for i := 0; i < count+attempts && (i < count || len(rtts) == 0); i++ {
+		if i > 0 {
+			s.limiter.wait()
+		}
+		sent++
+		var duration time.Duration
+		var v []string
+		var err error
+		if *flows > 0 {
+			duration, v, err = flowPing(ip, src, timeout, i%*flows)
+		} else {
+			duration, v, err = s.probe(ip, src, timeout)
+		}
+		if traced(ip) {
+			traceProbe("探测结束", ip, time.Now(), "mode", *mode, "attempt", i+1, "source", src, "latency", duration, "err", err)
+		}
+		if err != nil {
+			slog.Debug("探测失败", "ip", ip, "attempt", i+1, "err", err)
+			lastErr = err
+			continue
+		}
+		if len(rtts) == 0 {
+			values = v
+		}
+		rtts = append(rtts, duration)
+		if f := i % max(*flows, 1); best != nil && (!flowOK[f] || duration < best[f]) {
+			best[f], flowOK[f] = duration, true
+		}
+	}
+	if len(rtts) == 0 {
+		return nil, sent, nil, lastErr
+	}
+	if best != nil {
+		values = append(values, flowColumns(best, flowOK, s.overhead)...)
+	}
+	return rtts, sent, values, nil
+}
+
+// newResult 由成功的探测构造结果，rtts 为 sent 次探测中各次成功的延迟。按开销校准修正延迟，
+// 以平均延迟作为结果的延迟，并补充逐个获取的附加列
+func (s *scanner) newResult(t target, src string, rtts []time.Duration, sent int, values []string) result {
+	ip := t.ip
+	for i := range rtts {
+		rtts[i] = max(rtts[i]-s.overhead, 0)
+	}
+	duration := meanLatency(rtts)
+
+	// 输入文件中的标签列排在最前，其后依次为探测方式和各项附加信息的列
+	extra := append(append([]string(nil), t.labels...), values...)
+	if *probeCount > 1 {
+		extra = append(extra, formatLoss(len(rtts), sent), formatValue(jitter(rtts)))
+		extra = append(extra, latencyPercentiles(rtts)...)
+	}
+	if s.pool != nil {
+		extra = append(extra, src)
+	}
+	if *colo {
+		code, err := fetchColo(ip, src)
+		if err != nil {
+			slog.Warn("获取数据中心失败", "ip", ip, "err", err)
+		}
+		extra = append(extra, code)
+	}
+
+	return result{ip: ip, latency: formatLatency(duration), duration: duration, extra: extra, rtts: rtts, sent: sent}
+}
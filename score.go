@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scoreVars 为 -score 表达式可用的单个目标的指标。延迟相关的变量单位为毫秒，均只统计成功的探测；
+// loss 为丢包百分比，speed 为 -speed-url 测得的下载速度(MB/s)
+var scoreVars = []string{"avg", "min", "max", "stddev", "p50", "p90", "p95", "p99", "jitter", "loss", "sent", "received", "speed"}
+
+// weightNames 为 -weights 的指标名及其在 -score 表达式中对应的变量
+var weightNames = map[string]string{
+	"latency": "avg",
+	"jitter":  "jitter",
+	"loss":    "loss",
+	"speed":   "speed",
+}
+
+// parseScore 编译 -score 表达式，或把 -weights 转换为等价的表达式，均未设置时返回 nil
+func parseScore(src, weightSpec string) (*expression, error) {
+	if src != "" && weightSpec != "" {
+		return nil, fmt.Errorf("-score 和 -weights 不能同时使用")
+	}
+	if weightSpec != "" {
+		var err error
+		src, err = weightsExpression(weightSpec)
+		if err != nil {
+			return nil, fmt.Errorf("无法解析 -weights: %v", err)
+		}
+	}
+	if src == "" {
+		return nil, nil
+	}
+
+	e, err := parseExpression(src, scoreVars)
+	if err != nil {
+		return nil, fmt.Errorf("无法解析 -score 表达式: %v", err)
+	}
+	if e.used["speed"] && *speedURL == "" {
+		return nil, fmt.Errorf("得分使用了下载速度，需要通过 -speed-url 测速")
+	}
+	return e, nil
+}
+
+// weightsExpression 把 latency=1,jitter=2,loss=10,speed=5 形式的权重转换为得分表达式，
+// 下载速度越高越好，因此从得分中减去
+func weightsExpression(spec string) (string, error) {
+	var terms []string
+	for _, part := range strings.Split(spec, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		v, known := weightNames[strings.TrimSpace(name)]
+		if !ok || !known {
+			return "", fmt.Errorf("无效的权重: %s", part)
+		}
+		w, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return "", fmt.Errorf("无效的权重: %s", part)
+		}
+		sign := "+"
+		if v == "speed" {
+			sign = "-"
+		}
+		terms = append(terms, fmt.Sprintf("%s %s*(%s)", sign, v, strconv.FormatFloat(w, 'f', -1, 64)))
+	}
+	return strings.TrimPrefix(strings.Join(terms, " "), "+ "), nil
+}
+
+// hostVars 汇总单个目标多次探测的指标，供 -score 表达式求值
+func hostVars(res result) map[string]float64 {
+	ms := sortedMillis(res.rtts)
+	var sum float64
+	for _, v := range ms {
+		sum += v
+	}
+	avg := sum / float64(len(ms))
+	var variance float64
+	for _, v := range ms {
+		variance += (v - avg) * (v - avg)
+	}
+
+	vars := map[string]float64{
+		"avg":      float64(res.duration) / 1e6,
+		"min":      ms[0],
+		"max":      ms[len(ms)-1],
+		"stddev":   math.Sqrt(variance / float64(len(ms))),
+		"jitter":   float64(jitter(res.rtts)) / 1e6,
+		"loss":     lossPercent(len(res.rtts), res.sent),
+		"sent":     float64(res.sent),
+		"received": float64(len(res.rtts)),
+		"speed":    res.speed,
+	}
+	for _, p := range []int{50, 90, 95, 99} {
+		vars["p"+strconv.Itoa(p)] = percentile(ms, p)
+	}
+	return vars
+}
+
+// rankByScore 对每个结果求值得分表达式并追加得分列，再按得分升序重新排列，得分相同时保持原有的延迟顺序
+func rankByScore(results []result, e *expression) {
+	scores := make([]float64, len(results))
+	for i := range results {
+		scores[i] = e.eval(hostVars(results[i]))
+		results[i].extra = append(results[i].extra, strconv.FormatFloat(scores[i], 'f', 2, 64))
+	}
+	order := make([]int, len(results))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] < scores[order[j]]
+	})
+	ranked := make([]result, len(results))
+	for i, k := range order {
+		ranked[i] = results[k]
+	}
+	copy(results, ranked)
+}
+
+// sortedMillis 返回以毫秒计并升序排列的各次探测延迟
+func sortedMillis(rtts []time.Duration) []float64 {
+	ms := make([]float64, len(rtts))
+	for i, d := range rtts {
+		ms[i] = float64(d) / 1e6
+	}
+	sort.Float64s(ms)
+	return ms
+}
+
+// latencyPercentiles 返回目标各次成功探测延迟的 P50、P90 和 P99 列
+func latencyPercentiles(rtts []time.Duration) []string {
+	ms := sortedMillis(rtts)
+	columns := make([]string, 0, 3)
+	for _, p := range []int{50, 90, 99} {
+		columns = append(columns, formatValue(time.Duration(percentile(ms, p)*1e6)))
+	}
+	return columns
+}
+
+// meanLatency 返回各次成功探测的平均延迟
+func meanLatency(rtts []time.Duration) time.Duration {
+	var sum time.Duration
+	for _, d := range rtts {
+		sum += d
+	}
+	return sum / time.Duration(len(rtts))
+}
+
+// jitter 返回相邻两次成功探测延迟之差绝对值的平均值，少于两次成功时为0
+func jitter(rtts []time.Duration) time.Duration {
+	if len(rtts) < 2 {
+		return 0
+	}
+	var sum time.Duration
+	for i := 1; i < len(rtts); i++ {
+		d := rtts[i] - rtts[i-1]
+		if d < 0 {
+			d = -d
+		}
+		sum += d
+	}
+	return sum / time.Duration(len(rtts)-1)
+}
+
+// lossPercent 返回探测的丢包百分比
+func lossPercent(received, sent int) float64 {
+	if sent == 0 {
+		return 0
+	}
+	return float64(sent-received) / float64(sent) * 100
+}
+
+func formatLoss(received, sent int) string {
+	return strconv.FormatFloat(lossPercent(received, sent), 'f', 1, 64) + "%"
+}
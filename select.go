@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// selectWriters 为 -select-format 支持的格式
+var selectWriters = map[string]func(w io.Writer, chosen []result, columns []string){
+	"plain": writeSelectPlain,
+	"json":  writeSelectJSON,
+	"env":   writeSelectEnv,
+}
+
+// validateSelect 检查 -select 相关参数
+func validateSelect() error {
+	if *selectMode == "" {
+		return nil
+	}
+	if *selectMode != "best" {
+		return fmt.Errorf("未知的选择方式: %s", *selectMode)
+	}
+	if *selectN < 1 {
+		return fmt.Errorf("-n 必须大于0")
+	}
+	if _, ok := selectWriters[*selectFormat]; !ok {
+		return fmt.Errorf("未知的选择输出格式: %s", *selectFormat)
+	}
+	return nil
+}
+
+// writeSelection 按 -select 从已排序的结果中选出前 -n 个端点，以供脚本读取的简单格式
+// 写入 -select-out，未指定文件时写到标准输出。返回写入的文件，写到标准输出时为空
+func writeSelection(results []result, columns []string) (string, error) {
+	if *selectMode == "" {
+		return "", nil
+	}
+	chosen := results[:min(*selectN, len(results))]
+
+	var w io.Writer = os.Stdout
+	if *selectOut != "" {
+		file, err := os.Create(*selectOut)
+		if err != nil {
+			return "", fmt.Errorf("无法创建文件: %v", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	bw := bufio.NewWriter(w)
+	selectWriters[*selectFormat](bw, chosen, columns)
+	if err := bw.Flush(); err != nil {
+		return "", fmt.Errorf("无法写入文件: %v", err)
+	}
+
+	if *selectOut == "" {
+		return "", nil
+	}
+	slog.Info("成功将选出的端点写入文件", "file", *selectOut, "selected", len(chosen))
+	return *selectOut, nil
+}
+
+// writeSelectPlain 每行输出一个IP
+func writeSelectPlain(w io.Writer, chosen []result, columns []string) {
+	for _, res := range chosen {
+		fmt.Fprintln(w, res.ip)
+	}
+}
+
+// writeSelectJSON 输出一个JSON数组，元素的字段与 jsonl 输出相同
+func writeSelectJSON(w io.Writer, chosen []result, columns []string) {
+	fmt.Fprint(w, "[")
+	for i, res := range chosen {
+		if i > 0 {
+			fmt.Fprint(w, ",")
+		}
+		w.Write(resultJSON(res, columns))
+	}
+	fmt.Fprintln(w, "]")
+}
+
+// writeSelectEnv 输出可被 shell 或 systemd EnvironmentFile 读取的变量:
+// 最优端点及其延迟、以空格分隔的全部选出端点和选出的数量
+func writeSelectEnv(w io.Writer, chosen []result, columns []string) {
+	ips := make([]string, len(chosen))
+	for i, res := range chosen {
+		ips[i] = res.ip
+	}
+	best, latency := "", ""
+	if len(chosen) > 0 {
+		best = chosen[0].ip
+		latency = strconv.FormatFloat(float64(chosen[0].duration)/1e6, 'f', -1, 64)
+	}
+	fmt.Fprintf(w, "ICMP_SCAN_BEST=%s\n", best)
+	fmt.Fprintf(w, "ICMP_SCAN_BEST_LATENCY_MS=%s\n", latency)
+	fmt.Fprintf(w, "ICMP_SCAN_SELECTED=\"%s\"\n", strings.Join(ips, " "))
+	fmt.Fprintf(w, "ICMP_SCAN_SELECTED_COUNT=%d\n", len(chosen))
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// session 为交互模式中累积的结果，同一IP只保留最近一次的结果
+type session struct {
+	s       *scanner
+	results []result
+	index   map[string]int
+}
+
+// shellCommand 为交互模式中的一条命令
+type shellCommand struct {
+	usage string
+	run   func(sess *session, args []string) error
+}
+
+var shellCommands map[string]shellCommand
+
+func init() {
+	shellCommands = map[string]shellCommand{
+		"ping":   {"ping <目标>...      探测一个或多个IP或主机名并加入会话", (*session).ping},
+		"scan":   {"scan <文件>         扫描目标文件中的全部目标并加入会话 (不保留标签列)", (*session).scan},
+		"top":    {"top [N]             按延迟列出会话中最快的 N 个结果，默认10", (*session).top},
+		"export": {"export <格式> <文件> 把会话中的结果写入文件，格式为 csv、json、jsonl 或 sqlite", (*session).export},
+		"set":    {"set <参数> <值>     修改命令行参数，如 set timeout 500ms、set mode tcp", (*session).set},
+		"clear":  {"clear               清空会话中的结果", (*session).clear},
+		"help":   {"help                列出可用的命令", (*session).help},
+	}
+}
+
+// runShell 实现 shell 子命令: 从标准输入逐行读取命令，对内存中的会话执行探测、查看和导出，
+// 便于交互式地排查问题。命令行参数作为会话的初始参数
+func runShell(args []string) {
+	flag.CommandLine.Parse(args)
+	if err := setupLogging(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+
+	s, err := newScanner()
+	if err != nil {
+		slog.Error(err.Error())
+		return
+	}
+	sess := &session{s: s, index: make(map[string]int)}
+
+	fmt.Println("输入 help 查看可用的命令，quit 退出")
+	in := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("icmp-scan> ")
+		if !in.Scan() {
+			fmt.Println()
+			return
+		}
+		fields := strings.Fields(in.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "quit" || fields[0] == "exit" {
+			return
+		}
+		cmd, ok := shellCommands[fields[0]]
+		if !ok {
+			fmt.Printf("未知的命令: %s，输入 help 查看可用的命令\n", fields[0])
+			continue
+		}
+		if err := cmd.run(sess, fields[1:]); err != nil {
+			fmt.Println("错误:", err)
+		}
+	}
+}
+
+// add 把一批结果合并进会话并按延迟重新排序
+func (sess *session) add(results []result) {
+	for _, res := range results {
+		if i, ok := sess.index[res.ip]; ok {
+			sess.results[i] = res
+			continue
+		}
+		sess.index[res.ip] = len(sess.results)
+		sess.results = append(sess.results, res)
+	}
+	sort.SliceStable(sess.results, func(i, j int) bool {
+		return sess.results[i].duration < sess.results[j].duration
+	})
+	for i, res := range sess.results {
+		sess.index[res.ip] = i
+	}
+}
+
+func (sess *session) ping(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("用法: %s", shellCommands["ping"].usage)
+	}
+	var results []result
+	for i, ip := range args {
+		if !validTarget(ip) {
+			fmt.Printf("%s: 无效的IP或主机名\n", ip)
+			continue
+		}
+		res, err := sess.s.probeTarget(target{ip: ip}, sess.s.pool.pick(i, ip))
+		if err != nil {
+			fmt.Printf("%s: 无响应 (%v)\n", ip, err)
+			continue
+		}
+		results = append(results, res)
+	}
+	sess.s.enrich(results)
+	printResults(os.Stdout, results, sess.s.columns)
+	sess.add(results)
+	return nil
+}
+
+func (sess *session) scan(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("用法: %s", shellCommands["scan"].usage)
+	}
+	old := inputFiles
+	inputFiles = fileList{args[0]}
+	targets, _, err := loadTargets()
+	inputFiles = old
+	if err != nil {
+		return err
+	}
+	for i := range targets {
+		targets[i].labels = nil
+	}
+
+	results := sess.s.run(targets)
+	sess.add(results)
+	fmt.Printf("%d 个目标中 %d 个有响应，会话中共 %d 个结果\n", len(targets), len(results), len(sess.results))
+	return nil
+}
+
+func (sess *session) top(args []string) error {
+	n := 10
+	if len(args) > 0 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+			return fmt.Errorf("用法: %s", shellCommands["top"].usage)
+		}
+	}
+	printResults(os.Stdout, sess.results[:min(n, len(sess.results))], sess.s.columns)
+	return nil
+}
+
+func (sess *session) export(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("用法: %s", shellCommands["export"].usage)
+	}
+	format, filename := args[0], args[1]
+
+	if format == "json" {
+		file, err := os.Create(filename)
+		if err != nil {
+			return fmt.Errorf("无法创建文件: %v", err)
+		}
+		defer file.Close()
+		bw := bufio.NewWriter(file)
+		writeSelectJSON(bw, sess.results, sess.s.columns)
+		if err := bw.Flush(); err != nil {
+			return fmt.Errorf("无法写入文件: %v", err)
+		}
+	} else {
+		write, ok := outputWriters[format]
+		if !ok {
+			return fmt.Errorf("未知的输出格式: %s，可用的格式: json, %s", format, strings.Join(outputFormats(), ", "))
+		}
+		if err := write(filename, sess.results, sess.s.columns); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("已将 %d 个结果写入 %s\n", len(sess.results), filename)
+	return nil
+}
+
+// set 修改一个命令行参数并按新参数重新创建扫描器。附加列发生变化时旧结果与新的列不再对应，因此清空会话
+func (sess *session) set(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("用法: %s", shellCommands["set"].usage)
+	}
+	name := strings.TrimPrefix(args[0], "-")
+	f := flag.Lookup(name)
+	if f == nil {
+		return fmt.Errorf("未知的参数: %s", name)
+	}
+	old := f.Value.String()
+	if err := flag.Set(name, args[1]); err != nil {
+		return err
+	}
+	// mode 对应的默认端口需要重新选择
+	if name == "mode" && flag.Lookup("port").Value.String() == strconv.Itoa(probes[old].port) {
+		*port = 0
+	}
+
+	s, err := newScanner()
+	if err != nil {
+		flag.Set(name, old)
+		return err
+	}
+	if !slices.Equal(s.columns, sess.s.columns) && len(sess.results) > 0 {
+		fmt.Printf("结果的列已改变，已清空会话中的 %d 个结果\n", len(sess.results))
+		sess.clear(nil)
+	}
+	sess.s = s
+	return nil
+}
+
+func (sess *session) clear(args []string) error {
+	sess.results = nil
+	sess.index = make(map[string]int)
+	return nil
+}
+
+func (sess *session) help(args []string) error {
+	names := make([]string, 0, len(shellCommands))
+	for name := range shellCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Println("  " + shellCommands[name].usage)
+	}
+	fmt.Println("  quit                退出")
+	return nil
+}
+
+// printResults 以对齐的表格输出结果
+func printResults(w io.Writer, results []result, columns []string) {
+	if len(results) == 0 {
+		fmt.Fprintln(w, "没有结果")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(append([]string{"IP地址", "网络延迟"}, columns...), "\t"))
+	for _, res := range results {
+		fmt.Fprintln(tw, strings.Join(append([]string{res.ip, res.latency}, res.extra...), "\t"))
+	}
+	tw.Flush()
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	_ "modernc.org/sqlite"
+)
+
+// outputSpec 为一个 -out 目标，格式为 格式=路径
+type outputSpec struct {
+	format string
+	path   string
+}
+
+// outputList 收集可重复指定的 -out 参数
+type outputList []outputSpec
+
+func (l *outputList) String() string {
+	var parts []string
+	for _, o := range *l {
+		parts = append(parts, o.format+"="+o.path)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *outputList) Set(value string) error {
+	format, path, ok := strings.Cut(value, "=")
+	if !ok || path == "" {
+		return fmt.Errorf("输出格式应为 格式=路径，如 csv=ip.csv")
+	}
+	if _, ok := outputWriters[format]; !ok {
+		return fmt.Errorf("未知的输出格式: %s，可用的格式: %s", format, strings.Join(outputFormats(), ", "))
+	}
+	*l = append(*l, outputSpec{format, path})
+	return nil
+}
+
+// outputWriters 为 -out 支持的输出格式
+var outputWriters = map[string]func(filename string, results []result, columns []string) error{
+	"csv":    writeCSV,
+	"jsonl":  writeJSONL,
+	"sqlite": writeSQLite,
+}
+
+func outputFormats() []string {
+	var names []string
+	for name := range outputWriters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeOutputs 并发地把结果写入所有 -out 目标，返回所有写入失败的错误
+func writeOutputs(outputs outputList, results []result, columns []string) error {
+	errs := make([]error, len(outputs))
+	var wg sync.WaitGroup
+	for i, out := range outputs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := outputWriters[out.format](out.path, results, columns); err != nil {
+				errs[i] = fmt.Errorf("写入 %s 失败: %v", out.path, err)
+				return
+			}
+			slog.Info("成功将结果写入文件", "format", out.format, "file", out.path, "results", len(results))
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// resultSink 在扫描过程中逐个接收结果，用于把结果实时推送到外部系统
+type resultSink interface {
+	send(res result, columns []string) error
+	close() error
+}
+
+// openSinks 按命令行参数连接所有实时推送目标，其中一个连接失败时关闭已连接的目标，
+// 不留下未关闭的连接和没有结束时间的扫描记录
+func openSinks() ([]resultSink, error) {
+	if *dbDSN == "" && os.Getenv("ICMP_SCAN_DB") == "" && (*dbRetain != "" || *dbRetainRows != 0) {
+		return nil, fmt.Errorf("-retain 和 -retain-rows 需要通过 -db 指定数据库")
+	}
+
+	var sinks []resultSink
+	fail := func(err error) ([]resultSink, error) {
+		for _, sink := range sinks {
+			if cerr := sink.close(); cerr != nil {
+				slog.Warn("关闭推送目标失败", "err", cerr)
+			}
+		}
+		return nil, err
+	}
+	if *mqttBroker != "" {
+		sink, err := newMQTTSink(*mqttBroker, *mqttTopic, byte(*mqttQoS))
+		if err != nil {
+			return fail(err)
+		}
+		sinks = append(sinks, sink)
+	}
+	if *redisURL != "" {
+		sink, err := newRedisSink(*redisURL, *redisPrefix, *redisTTL)
+		if err != nil {
+			return fail(err)
+		}
+		sinks = append(sinks, sink)
+	}
+	if *dbDSN != "" || os.Getenv("ICMP_SCAN_DB") != "" {
+		sink, err := newDBSink(*dbDSN)
+		if err != nil {
+			return fail(err)
+		}
+		sinks = append(sinks, sink)
+	}
+	if *kafkaBrokers != "" {
+		sink, err := newKafkaSink(*kafkaBrokers, *kafkaTopic)
+		if err != nil {
+			return fail(err)
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+// writeJSONL 将每个结果写为一行JSON对象，延迟以 -unit 为单位，附加列以列名为键。设置了 -metadata 时第一行为元数据
+func writeJSONL(filename string, results []result, columns []string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("无法创建文件: %v", err)
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	if runMeta != nil {
+		w.Write(runMeta.jsonPreamble())
+		w.WriteByte('\n')
+	}
+	for _, res := range results {
+		w.Write(resultJSON(res, columns))
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("无法写入文件: %v", err)
+	}
+	return nil
+}
+
+// resultJSON 将结果编码为JSON对象，手动拼接以保持与CSV一致的列顺序。第一个键为输出格式的版本 schema_version，
+// 延迟的键名带有 -unit 单位，如 latency_ms
+func resultJSON(res result, columns []string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, `{"schema_version":%d,"ip":%s,"latency_%s":%s`, schemaVersion, jsonString(res.ip), *unit, formatValue(res.duration))
+	for i, col := range columns {
+		fmt.Fprintf(&b, ",%s:%s", jsonString(headerName(col)), jsonString(res.extra[i]))
+	}
+	b.WriteString("}")
+	return []byte(b.String())
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// writeSQLite 将结果写入SQLite数据库的 results 表，已存在的表会被替换。
+// 延迟以 -unit 为单位存为REAL，字段名如 latency_ms，附加列以列名为字段名存为TEXT
+func writeSQLite(filename string, results []result, columns []string) error {
+	db, err := sql.Open("sqlite", filename)
+	if err != nil {
+		return fmt.Errorf("无法打开数据库: %v", err)
+	}
+	defer db.Close()
+
+	fields := []string{"ip TEXT", "latency_" + *unit + " REAL"}
+	placeholders := []string{"?", "?"}
+	for _, col := range columns {
+		fields = append(fields, sqlIdent(headerName(col))+" TEXT")
+		placeholders = append(placeholders, "?")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("无法开始事务: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DROP TABLE IF EXISTS results"); err != nil {
+		return fmt.Errorf("无法删除旧表: %v", err)
+	}
+	if _, err := tx.Exec("CREATE TABLE results (" + strings.Join(fields, ", ") + ")"); err != nil {
+		return fmt.Errorf("无法创建表: %v", err)
+	}
+	if runMeta != nil {
+		if _, err := tx.Exec("DROP TABLE IF EXISTS metadata"); err != nil {
+			return fmt.Errorf("无法删除旧表: %v", err)
+		}
+		if _, err := tx.Exec("CREATE TABLE metadata (key TEXT, value TEXT)"); err != nil {
+			return fmt.Errorf("无法创建表: %v", err)
+		}
+		for _, row := range runMeta.sqliteRows() {
+			if _, err := tx.Exec("INSERT INTO metadata VALUES (?, ?)", row[0], row[1]); err != nil {
+				return fmt.Errorf("无法写入元数据: %v", err)
+			}
+		}
+	}
+
+	stmt, err := tx.Prepare("INSERT INTO results VALUES (" + strings.Join(placeholders, ", ") + ")")
+	if err != nil {
+		return fmt.Errorf("无法准备插入语句: %v", err)
+	}
+	defer stmt.Close()
+
+	for _, res := range results {
+		args := []any{res.ip, latencyValue(res.duration)}
+		for _, v := range res.extra {
+			args = append(args, v)
+		}
+		if _, err := stmt.Exec(args...); err != nil {
+			return fmt.Errorf("无法插入结果: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("无法提交事务: %v", err)
+	}
+	return nil
+}
+
+// sqlIdent 将列名转为带引号的SQL标识符
+func sqlIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
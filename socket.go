@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// listen 创建探测使用的ICMP套接字，按需进入指定的网络命名空间并绑定到VRF设备
+func listen(network, src string) (net.PacketConn, error) {
+	var conn net.PacketConn
+	err := withNetns(*netns, func() error {
+		lc := net.ListenConfig{Control: socketControl}
+		var err error
+		conn, err = lc.ListenPacket(context.Background(), network, src)
+		return err
+	})
+	return conn, err
+}
+
+// exchangeUDP 从本机向 ip:port 发送一个UDP报文，返回第一个来自该地址且被 match 接受的应答及往返耗时
+func exchangeUDP(ip, src string, timeout time.Duration, msg []byte, match func([]byte) bool) ([]byte, time.Duration, error) {
+	network, local := "udp4", "0.0.0.0"
+	if strings.Contains(ip, ":") {
+		network, local = "udp6", "::"
+	}
+	if src != "" {
+		local = src
+	}
+
+	conn, err := listen(network, net.JoinHostPort(local, "0"))
+	if err != nil {
+		return nil, 0, fmt.Errorf("创建UDP连接失败: %v", err)
+	}
+	defer conn.Close()
+
+	dst, err := net.ResolveUDPAddr(network, net.JoinHostPort(ip, strconv.Itoa(*port)))
+	if err != nil {
+		return nil, 0, fmt.Errorf("解析IP地址失败: %v", err)
+	}
+
+	kernelTS := *kernelTime && enableKernelTimestamps(conn)
+	trace := traced(ip, dst.IP.String())
+	start := time.Now()
+	if _, err := conn.WriteTo(msg, dst); err != nil {
+		return nil, 0, fmt.Errorf("发送UDP请求失败: %v", err)
+	}
+	if trace {
+		traceProbe("发送", dst.String(), start, "local", conn.LocalAddr().String(), "bytes", len(msg))
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+
+	for {
+		rb := make([]byte, 65535)
+		n, peer, received, err := readTimestamped(conn, rb, kernelTS)
+		if err != nil {
+			if trace {
+				traceProbe("接收失败", dst.String(), time.Now(), "err", err)
+			}
+			return nil, 0, fmt.Errorf("接收UDP应答失败: %v", err)
+		}
+		// 忽略来自其他地址或不属于本次请求的报文
+		if peer.String() != dst.String() || !match(rb[:n]) {
+			if trace {
+				traceProbe("忽略报文", dst.String(), received, "from", peer.String(), "bytes", n)
+			}
+			continue
+		}
+		if trace {
+			traceProbe("接收", dst.String(), received, "bytes", n, "rtt", received.Sub(start))
+		}
+		return rb[:n], received.Sub(start), nil
+	}
+}
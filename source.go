@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"strings"
+)
+
+// sourcePool 保存按地址族划分的源地址，用于把目标分片到多个源接口/IP上
+type sourcePool struct {
+	v4    []string
+	v6    []string
+	shard string
+}
+
+// newSourcePool 解析逗号分隔的源接口名或IP列表，接口名会展开为该接口上的地址
+func newSourcePool(list, shard string) (*sourcePool, error) {
+	if shard != "rr" && shard != "hash" {
+		return nil, fmt.Errorf("未知的分片方式: %s", shard)
+	}
+
+	pool := &sourcePool{shard: shard}
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if ip := net.ParseIP(item); ip != nil {
+			pool.add(ip)
+			continue
+		}
+
+		iface, err := net.InterfaceByName(item)
+		if err != nil {
+			return nil, fmt.Errorf("无法识别源接口或IP %s: %v", item, err)
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("无法获取接口 %s 的地址: %v", item, err)
+		}
+
+		found := false
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || ipnet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			pool.add(ipnet.IP)
+			found = true
+		}
+		if !found {
+			return nil, fmt.Errorf("接口 %s 上没有可用的地址", item)
+		}
+	}
+
+	if len(pool.v4) == 0 && len(pool.v6) == 0 {
+		return nil, fmt.Errorf("没有指定有效的源接口或IP")
+	}
+
+	return pool, nil
+}
+
+func (p *sourcePool) add(ip net.IP) {
+	if ip.To4() != nil {
+		p.v4 = append(p.v4, ip.String())
+	} else {
+		p.v6 = append(p.v6, ip.String())
+	}
+}
+
+// pick 为第 index 个目标选择源地址，返回空字符串表示使用系统默认地址
+func (p *sourcePool) pick(index int, ip string) string {
+	if p == nil {
+		return ""
+	}
+
+	sources := p.v4
+	if strings.Contains(ip, ":") {
+		sources = p.v6
+	}
+	if len(sources) == 0 {
+		return ""
+	}
+
+	if p.shard == "hash" {
+		h := fnv.New32a()
+		h.Write([]byte(ip))
+		return sources[h.Sum32()%uint32(len(sources))]
+	}
+
+	return sources[index%len(sources)]
+}
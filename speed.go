@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// validateSpeedURL 检查 -speed-url 是否为可用于测速的 HTTP(S) 地址
+func validateSpeedURL() error {
+	if *speedURL == "" {
+		return nil
+	}
+	u, err := url.Parse(*speedURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("无效的测速地址: %s", *speedURL)
+	}
+	if *speedN < 1 || *speedTime <= 0 {
+		return fmt.Errorf("-speed-n 和 -speed-time 必须大于0")
+	}
+	return nil
+}
+
+// enrichSpeed 依次对延迟最低的前 -speed-n 个结果测量下载速度并追加下载速度列，其余结果该列为空。
+// 各地址的测速共享本机带宽，因此逐个进行
+func enrichSpeed(results []result, pool *sourcePool) {
+	n := min(*speedN, len(results))
+	slog.Info("正在测量下载速度", "results", n, "url", *speedURL)
+	for i := range results {
+		if i >= n {
+			results[i].extra = append(results[i].extra, "")
+			continue
+		}
+		speed, err := measureSpeed(results[i].ip, pool.pick(i, results[i].ip))
+		if err != nil {
+			slog.Warn("测量下载速度失败", "ip", results[i].ip, "err", err)
+			results[i].extra = append(results[i].extra, "")
+			continue
+		}
+		slog.Debug("测速完成", "ip", results[i].ip, "speed", speed)
+		results[i].speed = speed
+		results[i].extra = append(results[i].extra, strconv.FormatFloat(speed, 'f', 2, 64)+" MB/s")
+	}
+}
+
+// measureSpeed 经由目标IP下载 -speed-url，以 -speed-time 内收到的字节数计算平均下载速度(MB/s)。
+// 连接发往目标IP，Host 头和 SNI 仍为URL中的域名
+func measureSpeed(ip, src string) (float64, error) {
+	u, err := url.Parse(*speedURL)
+	if err != nil {
+		return 0, err
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dialTarget(ctx, src, net.JoinHostPort(ip, port))
+			},
+			TLSClientConfig:   &tls.Config{ServerName: u.Hostname()},
+			DisableKeepAlives: true,
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *speedTime)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("构造HTTP请求失败: %v", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("HTTP请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("下载返回 %s", resp.Status)
+	}
+
+	start := time.Now()
+	n, err := io.Copy(io.Discard, resp.Body)
+	elapsed := time.Since(start)
+	// 达到 -speed-time 时停止下载，以已收到的数据计算速度
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return 0, fmt.Errorf("下载失败: %v", err)
+	}
+	if n == 0 || elapsed <= 0 {
+		return 0, fmt.Errorf("没有收到数据")
+	}
+	return float64(n) / 1e6 / elapsed.Seconds(), nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"math/bits"
+	"math/rand"
+	"net/netip"
+	"os"
+	"os/signal"
+	"sort"
+)
+
+// routableRange 为 bogons 之外的一段连续地址，offset 为该段第一个地址在所有可路由地址中的序号
+type routableRange struct {
+	start, end uint32
+	offset     uint64
+}
+
+// routableSpace 把全部可路由IPv4地址编号为 0..size-1
+type routableSpace struct {
+	ranges []routableRange
+	size   uint64
+}
+
+func newRoutableSpace() *routableSpace {
+	type span struct{ start, end uint64 }
+	var excluded []span
+	for _, p := range bogons {
+		start := uint64(binary.BigEndian.Uint32(p.Addr().AsSlice()))
+		excluded = append(excluded, span{start, start + 1<<(32-p.Bits()) - 1})
+	}
+	sort.Slice(excluded, func(i, j int) bool { return excluded[i].start < excluded[j].start })
+
+	rs := &routableSpace{}
+	var next uint64
+	for _, ex := range excluded {
+		if ex.start > next {
+			rs.ranges = append(rs.ranges, routableRange{uint32(next), uint32(ex.start - 1), rs.size})
+			rs.size += ex.start - next
+		}
+		next = max(next, ex.end+1)
+	}
+	if next <= 0xffffffff {
+		rs.ranges = append(rs.ranges, routableRange{uint32(next), 0xffffffff, rs.size})
+		rs.size += 1<<32 - next
+	}
+	return rs
+}
+
+// addr 返回序号为 n 的可路由地址
+func (rs *routableSpace) addr(n uint64) netip.Addr {
+	i := sort.Search(len(rs.ranges), func(i int) bool {
+		r := rs.ranges[i]
+		return r.offset+uint64(r.end-r.start) >= n
+	})
+	r := rs.ranges[i]
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], r.start+uint32(n-r.offset))
+	return netip.AddrFrom4(b)
+}
+
+// permutation 为 [0, size) 上由种子决定的伪随机排列，在不小于 size 的最小的 2^(2*half) 空间上
+// 使用4轮 Feistel 网络，并通过循环迭代把结果限制在 size 以内。size 不超过 2^32，可路由地址空间的 half 为16
+type permutation struct {
+	keys [4]uint32
+	size uint64
+	half uint
+}
+
+func newPermutation(size uint64, rng *rand.Rand) *permutation {
+	p := &permutation{size: size, half: max(uint(bits.Len64(size-1)+1)/2, 1)}
+	for i := range p.keys {
+		p.keys[i] = rng.Uint32()
+	}
+	return p
+}
+
+func (p *permutation) feistel(x uint32) uint32 {
+	mask := uint32(1)<<p.half - 1
+	l, r := x>>p.half, x&mask
+	for _, k := range p.keys {
+		f := (r*0x9e3779b1 ^ k) * 0x85ebca6b
+		l, r = r, l^(f>>16)&mask
+	}
+	return l<<p.half | r
+}
+
+func (p *permutation) at(i uint64) uint64 {
+	x := uint32(i)
+	for {
+		x = p.feistel(x)
+		if uint64(x) < p.size {
+			return uint64(x)
+		}
+	}
+}
+
+// sweep 按 -seed 决定的顺序遍历全部可路由IPv4地址，从第 -resume 个开始。
+// 收到中断信号或被停止后不再派发新探测，等待已发出的探测完成并提示继续扫描的参数
+func (s *scanner) sweep() []result {
+	space := newRoutableSpace()
+	if *resume >= space.size {
+		slog.Error("起始序号超出可路由地址总数", "resume", *resume, "total", space.size)
+		return nil
+	}
+
+	perm := newPermutation(space.size, seededRand())
+	slog.Info("全网扫描", "seed", *seed, "resume", *resume, "total", space.size)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var dispatched uint64
+	targets := make(chan target)
+	go func() {
+		defer close(targets)
+		for i := *resume; i < space.size; i++ {
+			select {
+			case targets <- target{ip: space.addr(perm.at(i)).String()}:
+				dispatched++
+			case <-ctx.Done():
+				// 暂停时中断也要让已分发的目标探测完，才能记录继续的位置
+				s.setPaused(false)
+				return
+			case <-s.halted:
+				return
+			}
+		}
+	}()
+
+	results := s.stream(targets, int64(space.size-*resume), nil)
+
+	if ctx.Err() != nil || dispatched < space.size-*resume {
+		slog.Warn(fmt.Sprintf("扫描已中断，使用 -sweep -seed %d -resume %d 继续", *seed, *resume+dispatched))
+	}
+	return results
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestPermutationBijection(t *testing.T) {
+	for _, size := range []uint64{1, 2, 3, 10, 255, 256, 1000, 4097, 65536} {
+		p := newPermutation(size, rand.New(rand.NewSource(int64(size))))
+		seen := make([]bool, size)
+		for i := uint64(0); i < size; i++ {
+			v := p.at(i)
+			if v >= size {
+				t.Fatalf("size %d: at(%d) = %d, out of range", size, i, v)
+			}
+			if seen[v] {
+				t.Fatalf("size %d: at(%d) = %d, produced twice", size, i, v)
+			}
+			seen[v] = true
+		}
+	}
+}
+
+// 可路由地址空间仍使用完整的32位 Feistel 网络，同一 -seed 和 -resume 的扫描顺序不变
+func TestPermutationRoutableSpace(t *testing.T) {
+	p := newPermutation(newRoutableSpace().size, rand.New(rand.NewSource(1)))
+	if p.half != 16 {
+		t.Errorf("half = %d, want 16", p.half)
+	}
+}
@@ -0,0 +1,661 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bogons 为不可在公网路由的IPv4地址段，随机生成目标时排除
+var bogons = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+}
+
+func isBogon(addr netip.Addr) bool {
+	for _, p := range bogons {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// seededRand 返回由 -seed 决定的随机数生成器。-seed 为0时先选择一个种子并打印，
+// 使 -random、-shuffle 和 -sweep 的随机行为都可以通过相同的 -seed 复现
+func seededRand() *rand.Rand {
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+		slog.Info("随机种子", "seed", *seed)
+	}
+	return rand.New(rand.NewSource(*seed))
+}
+
+// target 为一个待探测的地址及其在输入文件中附带的标签，hosts 为解析出该地址的主机名目标
+type target struct {
+	ip     string
+	labels []string
+	hosts  []string
+	origin string // 输入中产生该目标的原始写法，如CIDR、模式或主机名
+	prefix string // 由CIDR展开的目标所属的网段 (花括号展开之后)，用于 -precheck 按网段抽样
+	opts   targetOptions
+}
+
+// targetOptions 为输入中为单个目标指定的探测参数，覆盖命令行上的同名参数，未指定的字段为零值。
+// maintenance 为目标另外适用的 -maintenance 中的具名维护时段，dep 为目标所依赖的网关等上级目标的地址，
+// priority 越大的目标越先探测
+type targetOptions struct {
+	timeout     time.Duration
+	count       int
+	retries     *int
+	maintenance string
+	dep         string
+	priority    int
+}
+
+// targetOptionNames 为输入中可以为单个目标指定的参数
+var targetOptionNames = map[string]bool{"timeout": true, "count": true, "retries": true, "maintenance": true, "dep": true, "priority": true}
+
+// parseTargetOptions 解析 名称=值 形式的目标参数
+func parseTargetOptions(options []string) (targetOptions, error) {
+	var opts targetOptions
+	for _, option := range options {
+		name, value, _ := strings.Cut(option, "=")
+		switch strings.ToLower(name) {
+		case "timeout":
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return opts, fmt.Errorf("无效的超时时间: %s", value)
+			}
+			opts.timeout = d
+		case "count":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return opts, fmt.Errorf("无效的探测次数: %s", value)
+			}
+			opts.count = n
+		case "retries":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return opts, fmt.Errorf("无效的重试次数: %s", value)
+			}
+			opts.retries = &n
+		case "maintenance":
+			if value == "" {
+				return opts, fmt.Errorf("缺少维护时段名称")
+			}
+			opts.maintenance = value
+		case "dep":
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return opts, fmt.Errorf("无效的上级目标地址: %s", value)
+			}
+			opts.dep = addr.String()
+		case "priority":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return opts, fmt.Errorf("无效的优先级: %s", value)
+			}
+			opts.priority = n
+		}
+	}
+	return opts, nil
+}
+
+// isTargetOption 判断字段是否为 名称=值 形式的目标参数
+func isTargetOption(field string) bool {
+	name, _, ok := strings.Cut(field, "=")
+	return ok && targetOptionNames[strings.ToLower(name)]
+}
+
+// fileList 为可重复指定的 -file
+type fileList []string
+
+func (l *fileList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *fileList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// names 返回要读取的目标文件，未指定 -file 时为 ip.txt
+func (l fileList) names() []string {
+	if len(l) == 0 {
+		return []string{"ip.txt"}
+	}
+	return l
+}
+
+// loadTargets 根据命令行参数生成随机目标或从各个 -file 读取目标，并按需打乱顺序。
+// 输入中指定了 priority= 的目标按优先级从高到低探测，同一优先级内保持输入 (或打乱后) 的顺序，低于 -min-priority 的目标不探测。
+// 返回的标签列名与每个目标的 labels 一一对应
+func loadTargets() ([]target, []string, error) {
+	if _, ok := resolvers[*resolver]; !ok {
+		return nil, nil, fmt.Errorf("未知的解析方式: %s", *resolver)
+	}
+
+	var targets []target
+	var labelColumns []string
+	if *randomCount > 0 {
+		n := *randomCount
+		if *maxTargets > 0 && n > *maxTargets {
+			if !*truncateTargets {
+				return nil, nil, fmt.Errorf("-random %d 超过 -max-targets %d，可使用 -truncate 截断", n, *maxTargets)
+			}
+			slog.Warn("目标数量超过 -max-targets，已截断", "max", *maxTargets)
+			n = *maxTargets
+		}
+		for _, ip := range randomTargets(n, seededRand()) {
+			targets = append(targets, target{ip: ip, origin: "random"})
+		}
+	} else {
+		var report validationReport
+		var err error
+		targets, labelColumns, err = readTargetFiles(inputFiles.names(), &report)
+		if err != nil {
+			return nil, nil, fmt.Errorf("无法从文件中读取IP: %v", err)
+		}
+
+		report.print()
+		if *rejectsFile != "" {
+			if err := report.writeRejects(*rejectsFile); err != nil {
+				return nil, nil, err
+			}
+		}
+		targets, labelColumns = resolveTargets(targets, labelColumns)
+	}
+	targets, labelColumns = addOriginColumn(targets, labelColumns)
+
+	if *shuffle {
+		rng := seededRand()
+		rng.Shuffle(len(targets), func(i, j int) { targets[i], targets[j] = targets[j], targets[i] })
+	}
+	// 上级目标只需在输入之中，被 -min-priority 略过的上级目标不判断其状态，下级目标的断开照常记录
+	if err := checkDependencies(targets); err != nil {
+		return nil, nil, err
+	}
+	if *minPriority > 0 {
+		targets = slices.DeleteFunc(targets, func(t target) bool { return t.opts.priority < *minPriority })
+	}
+	slices.SortStableFunc(targets, func(a, b target) int { return b.opts.priority - a.opts.priority })
+	return targets, labelColumns, nil
+}
+
+// resolveTargets 按需解析从文件读取的目标中的主机名，设置了 -resolve-all 或使用非系统解析时追加主机名列
+func resolveTargets(targets []target, labelColumns []string) ([]target, []string) {
+	// 不使用系统解析时主机名必须在扫描前解析，同 -resolve-all
+	expandAll := *resolveAll || *resolver != "system"
+	if *hostsOut != "" || expandAll {
+		targets = expandHostnames(targets)
+	}
+	// 同一主机名解析出的多个地址共享标签切片，追加主机名列前先复制
+	if expandAll {
+		labelColumns = append(labelColumns, "主机名")
+		for i := range targets {
+			targets[i].labels = append(append([]string(nil), targets[i].labels...), strings.Join(targets[i].hosts, " "))
+		}
+	}
+	return targets, labelColumns
+}
+
+// addOriginColumn 设置了 -origin 时追加原始目标列
+func addOriginColumn(targets []target, labelColumns []string) ([]target, []string) {
+	if *originColumn {
+		labelColumns = append(labelColumns, "原始目标")
+		for i := range targets {
+			targets[i].labels = append(append([]string(nil), targets[i].labels...), targets[i].origin)
+		}
+	}
+	return targets, labelColumns
+}
+
+// randomTargets 生成 n 个互不重复的可路由IPv4地址
+func randomTargets(n int, rng *rand.Rand) []string {
+	seen := make(map[uint32]bool, n)
+	ips := make([]string, 0, n)
+	var b [4]byte
+	for len(ips) < n {
+		v := rng.Uint32()
+		binary.BigEndian.PutUint32(b[:], v)
+		addr := netip.AddrFrom4(b)
+		if seen[v] || isBogon(addr) {
+			continue
+		}
+		seen[v] = true
+		ips = append(ips, addr.String())
+	}
+	return ips
+}
+
+// ipHeaders 为CSV输入表头中可以作为地址列的列名
+var ipHeaders = map[string]bool{"ip": true, "address": true, "addr": true, "host": true, "target": true, "ip地址": true}
+
+// readTargetFiles 依次读取各个目标文件并合并。同一目标在多个文件中出现时只保留第一次，
+// 其余计为重复；各文件的标签列按列名合并，文件中没有的标签列为空。!CIDR 行同样移除之前的文件中的目标
+func readTargetFiles(filenames []string, report *validationReport) ([]target, []string, error) {
+	var all []target
+	var labelColumns []string
+	seen := make(map[string]bool)
+	for _, filename := range filenames {
+		report.file = filename
+		targets, columns, err := readIPs(filename, report, seen, &all)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// index[i] 为该文件第 i 个标签列在合并后的标签列中的位置
+		index := make([]int, len(columns))
+		for i, col := range columns {
+			index[i] = slices.Index(labelColumns, col)
+			if index[i] < 0 {
+				index[i] = len(labelColumns)
+				labelColumns = append(labelColumns, col)
+			}
+		}
+		for _, t := range targets {
+			labels := make([]string, len(labelColumns))
+			for i, v := range t.labels {
+				labels[index[i]] = v
+			}
+			t.labels = labels
+			all = append(all, t)
+		}
+	}
+
+	// 后面的文件增加了标签列时补齐之前的目标
+	for i := range all {
+		if len(all[i].labels) < len(labelColumns) {
+			labels := make([]string, len(labelColumns))
+			copy(labels, all[i].labels)
+			all[i].labels = labels
+		}
+	}
+	report.targets = len(all)
+	return all, labelColumns, nil
+}
+
+// readIPs 读取目标文件，每行为 目标[,标签...]。第一行的某一列名为 ip、host、target 等时将其视为表头，
+// 该列为地址列，其余列名作为标签列名；没有表头时标签列依次命名为 标签、标签2 ...
+// 目标后可以用空格分隔或作为单独的列写出 timeout=200ms、count=5、retries=1 等目标参数，表头中名为
+// timeout、count 或 retries 的列也作为参数列而不是标签列。
+// 空行和以 # 开头的行被忽略，无效的行和重复的目标记录到 report 中。seen 为之前的文件中已读取的目标，
+// earlier 为这些目标本身，用于合并多个文件时去重、计算 -max-targets 和按 !CIDR 行移除
+func readIPs(filename string, report *validationReport, seen map[string]bool, earlier *[]target) ([]target, []string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	var targets []target
+	var labelColumns []string
+	ipColumn, maxLabels := 0, 0
+	optionColumns := make(map[int]string)
+	first := true
+
+	// remaining 返回距离 -max-targets 还能加入的目标数，不限制时返回 -1
+	remaining := func() int {
+		if *maxTargets <= 0 {
+			return -1
+		}
+		return max(*maxTargets-len(*earlier)-len(targets), 0)
+	}
+	truncated := false
+
+	add := func(lineNo int, ip, origin, prefix string, labels []string, opts targetOptions) {
+		if seen[ip] {
+			report.duplicates++
+			report.reject(lineNo, ip, "重复的目标")
+			return
+		}
+		if remaining() == 0 {
+			truncated = true
+			return
+		}
+		seen[ip] = true
+		targets = append(targets, target{ip: ip, labels: labels, origin: origin, prefix: prefix, opts: opts})
+	}
+
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		report.lines++
+
+		fields := splitFields(text)
+		if first {
+			first = false
+			if col := headerColumn(fields); col >= 0 {
+				ipColumn = col
+				for i, f := range fields {
+					if targetOptionNames[strings.ToLower(f)] {
+						optionColumns[i] = strings.ToLower(f)
+					} else if i != ipColumn {
+						labelColumns = append(labelColumns, f)
+					}
+				}
+				continue
+			}
+		}
+
+		var spec string
+		var labels, options []string
+		for i, f := range fields {
+			if i == ipColumn {
+				// 地址后以空格分隔的 名称=值 为目标参数
+				tokens := strings.Fields(f)
+				if len(tokens) > 1 && !slices.ContainsFunc(tokens[1:], func(t string) bool { return !isTargetOption(t) }) {
+					spec, options = tokens[0], append(options, tokens[1:]...)
+				} else {
+					spec = f
+				}
+			} else if name, ok := optionColumns[i]; ok {
+				if f != "" {
+					options = append(options, name+"="+f)
+				}
+			} else if isTargetOption(f) {
+				options = append(options, f)
+			} else {
+				labels = append(labels, f)
+			}
+		}
+		opts, err := parseTargetOptions(options)
+		if err != nil {
+			report.reject(lineNo, text, "无效的目标参数")
+			continue
+		}
+		if strings.HasPrefix(spec, "!") {
+			prefix, err := parseExclusion(spec[1:])
+			if err != nil {
+				report.reject(lineNo, text, "无法解析排除范围")
+				continue
+			}
+			// 被排除的目标之后的行仍可重新加入
+			excluded := func(t target) bool {
+				if addr, err := netip.ParseAddr(t.ip); err == nil && prefix.Contains(addr.WithZone("").Unmap()) {
+					delete(seen, t.ip)
+					report.excluded++
+					return true
+				}
+				return false
+			}
+			*earlier = slices.DeleteFunc(*earlier, excluded)
+			targets = slices.DeleteFunc(targets, excluded)
+			continue
+		}
+		maxLabels = max(maxLabels, len(labels))
+
+		if spec == "" {
+			report.reject(lineNo, text, "缺少目标地址")
+			continue
+		}
+
+		// 多展开一个以判断是否超过 -max-targets，避免误写的 {0..999999999} 耗尽内存
+		limit := remaining()
+		if limit >= 0 {
+			limit++
+		}
+		patterns, err := expandBraces(spec, limit)
+		if err != nil {
+			report.reject(lineNo, text, "无法展开模式")
+			continue
+		}
+		if limit >= 0 && len(patterns) >= limit && strings.Contains(spec, "{") && !*truncateTargets {
+			return nil, nil, fmt.Errorf("%s 第 %d 行的 %s 展开后目标总数将超过 -max-targets %d，可使用 -truncate 截断", filename, lineNo, spec, *maxTargets)
+		}
+
+		for _, line := range patterns {
+			if strings.Contains(line, "/") {
+				// CIDR格式，展开前先检查数量，避免误写的 0.0.0.0/0 耗尽内存
+				_, ipnet, err := net.ParseCIDR(line)
+				if err != nil {
+					report.reject(lineNo, line, "无法解析CIDR")
+					continue
+				}
+				if left := remaining(); left >= 0 && cidrHosts(ipnet) > uint64(left) {
+					if !*truncateTargets {
+						return nil, nil, fmt.Errorf("%s 第 %d 行的 %s 展开后目标总数将超过 -max-targets %d，可使用 -truncate 截断", filename, lineNo, line, *maxTargets)
+					}
+					truncated = true
+				}
+
+				expandedIPs, err := expandCIDR(line, remaining())
+				if err != nil {
+					report.reject(lineNo, line, "无法解析CIDR")
+					continue
+				}
+				for _, ip := range expandedIPs {
+					add(lineNo, ip, spec, ipnet.String(), labels, opts)
+				}
+			} else if validTarget(line) {
+				if remaining() == 0 && !seen[line] && !*truncateTargets {
+					return nil, nil, fmt.Errorf("%s 第 %d 行的目标使总数超过 -max-targets %d，可使用 -truncate 截断", filename, lineNo, *maxTargets)
+				}
+				add(lineNo, line, spec, "", labels, opts)
+			} else {
+				report.reject(lineNo, line, "无效的IP或主机名")
+			}
+		}
+	}
+	if truncated {
+		slog.Warn("目标数量超过 -max-targets，已截断", "max", *maxTargets)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if labelColumns == nil {
+		for i := 0; i < maxLabels; i++ {
+			name := "标签"
+			if i > 0 {
+				name += strconv.Itoa(i + 1)
+			}
+			labelColumns = append(labelColumns, name)
+		}
+	}
+
+	// 补齐缺少标签的行，使每个目标的标签数与标签列一致
+	for i := range targets {
+		if len(targets[i].labels) < len(labelColumns) {
+			labels := make([]string, len(labelColumns))
+			copy(labels, targets[i].labels)
+			targets[i].labels = labels
+		}
+	}
+
+	return targets, labelColumns, nil
+}
+
+// parseExclusion 解析排除行 !CIDR 或 !IP 中的范围，单个地址视为只包含它的前缀
+func parseExclusion(spec string) (netip.Prefix, error) {
+	if strings.Contains(spec, "/") {
+		prefix, err := netip.ParsePrefix(spec)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(spec)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.WithZone("").Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// headerColumn 返回表头中地址列的位置，不是表头时返回 -1
+func headerColumn(fields []string) int {
+	if len(fields) < 2 {
+		return -1
+	}
+	for i, f := range fields {
+		if ipHeaders[strings.ToLower(f)] {
+			return i
+		}
+	}
+	return -1
+}
+
+// splitFields 按逗号拆分一行，花括号模式内部的逗号不作为分隔符
+func splitFields(line string) []string {
+	var fields []string
+	depth, start := 0, 0
+	for i, c := range line {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				fields = append(fields, strings.TrimSpace(line[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(fields, strings.TrimSpace(line[start:]))
+}
+
+// cidrHosts 返回CIDR展开后的地址数量(不含网络地址和广播地址)，超大的IPv6前缀按饱和值计算
+func cidrHosts(ipnet *net.IPNet) uint64 {
+	ones, bits := ipnet.Mask.Size()
+	hostBits := bits - ones
+	if hostBits >= 62 {
+		return 1 << 62
+	}
+	n := uint64(1) << hostBits
+	if n > 2 {
+		n -= 2
+	}
+	return n
+}
+
+// expandCIDR 展开CIDR为具体的IP地址，limit 不小于0时最多返回 limit 个地址
+func expandCIDR(cidr string, limit int) ([]string, error) {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := cidrHosts(ipnet)
+	if limit < 0 || uint64(limit) > hosts {
+		limit = int(hosts)
+	}
+
+	ip := ipnet.IP.Mask(ipnet.Mask)
+	// 删除网络地址和广播地址（如果适用）
+	if ones, bits := ipnet.Mask.Size(); bits-ones > 1 {
+		incrementIP(ip)
+	}
+
+	// 不限制数量时超大的前缀仍逐个追加，预分配的容量有上限
+	ips := make([]string, 0, min(limit, 1<<16))
+	for len(ips) < limit {
+		ips = append(ips, ip.String())
+		incrementIP(ip)
+	}
+
+	return ips, nil
+}
+
+func incrementIP(ip net.IP) {
+	for j := len(ip) - 1; j >= 0; j-- {
+		ip[j]++
+		if ip[j] > 0 {
+			break
+		}
+	}
+}
+
+// expandBraces 展开 node{01..40}.example.com、10.0.{1..8}.1 和 {a,b} 形式的模式，
+// 数字范围的任一端带前导零时按其宽度补零，多个花括号按笛卡尔积展开，不支持嵌套。limit 不小于0时最多返回 limit 个结果
+func expandBraces(pattern string, limit int) ([]string, error) {
+	open := strings.IndexByte(pattern, '{')
+	if open < 0 {
+		if limit == 0 {
+			return nil, nil
+		}
+		return []string{pattern}, nil
+	}
+	end := strings.IndexByte(pattern[open:], '}')
+	if end < 0 {
+		return nil, fmt.Errorf("花括号未闭合")
+	}
+	end += open
+
+	prefix, body, suffix := pattern[:open], pattern[open+1:end], pattern[end+1:]
+	if strings.ContainsRune(body, '{') {
+		return nil, fmt.Errorf("不支持嵌套的花括号")
+	}
+
+	var items []string
+	if lo, hi, ok := strings.Cut(body, ".."); ok {
+		from, err1 := strconv.Atoi(lo)
+		to, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("无效的数字范围 {%s}", body)
+		}
+
+		width := 0
+		if (len(lo) > 1 && lo[0] == '0') || (len(hi) > 1 && hi[0] == '0') {
+			width = max(len(lo), len(hi))
+		}
+
+		step := 1
+		if from > to {
+			step = -1
+		}
+		for n := from; limit < 0 || len(items) < limit; n += step {
+			items = append(items, fmt.Sprintf("%0*d", width, n))
+			if n == to {
+				break
+			}
+		}
+	} else {
+		items = strings.Split(body, ",")
+	}
+
+	rest, err := expandBraces(suffix, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+	for _, item := range items {
+		for _, r := range rest {
+			if limit >= 0 && len(out) >= limit {
+				return out, nil
+			}
+			out = append(out, prefix+item+r)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExpandBraces(t *testing.T) {
+	tests := []struct {
+		pattern string
+		limit   int
+		want    []string
+		wantErr bool
+	}{
+		{pattern: "10.0.0.1", limit: -1, want: []string{"10.0.0.1"}},
+		{pattern: "node{01..03}.example.com", limit: -1, want: []string{"node01.example.com", "node02.example.com", "node03.example.com"}},
+		{pattern: "h{8..10}", limit: -1, want: []string{"h8", "h9", "h10"}},
+		{pattern: "h{3..1}", limit: -1, want: []string{"h3", "h2", "h1"}},
+		{pattern: "h{007..9}", limit: -1, want: []string{"h007", "h008", "h009"}},
+		{pattern: "{a,b}.example.com", limit: -1, want: []string{"a.example.com", "b.example.com"}},
+		{pattern: "10.{0..1}.{1..2}.1", limit: -1, want: []string{"10.0.1.1", "10.0.2.1", "10.1.1.1", "10.1.2.1"}},
+		{pattern: "a{1,{2,3}}", limit: -1, wantErr: true},
+		{pattern: "10.0.{1..3.1", limit: -1, wantErr: true},
+		{pattern: "{a..b}", limit: -1, wantErr: true},
+		{pattern: "{1..}", limit: -1, wantErr: true},
+		{pattern: "x{1..2}{a..b}", limit: -1, wantErr: true},
+		{pattern: "10.0.{0..999999999}.1", limit: 3, want: []string{"10.0.0.1", "10.0.1.1", "10.0.2.1"}},
+		{pattern: "{a,b}{1..3}", limit: 4, want: []string{"a1", "a2", "a3", "b1"}},
+		{pattern: "{1..5}", limit: 0, want: nil},
+		{pattern: "10.0.0.1", limit: 0, want: nil},
+	}
+	for _, tt := range tests {
+		got, err := expandBraces(tt.pattern, tt.limit)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("expandBraces(%q, %d) = %q, want error", tt.pattern, tt.limit, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("expandBraces(%q, %d) error: %v", tt.pattern, tt.limit, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("expandBraces(%q, %d) = %q, want %q", tt.pattern, tt.limit, got, tt.want)
+		}
+	}
+}
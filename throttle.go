@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/netip"
+	"sync"
+)
+
+// errTimeout 表示探测在 -timeout 内没有收到应答，-adaptive 只把这类失败视为可能的限速
+var errTimeout = errors.New("超时")
+
+const (
+	throttleStreak = 5  // 网段内出现过应答后连续超时达到该次数即判定为疑似限速
+	throttlePPS    = 10 // 疑似限速网段初始的每秒探测数，此后每出现一轮连续超时减半
+)
+
+// prefixState 记录一个网段 (IPv4 /24、IPv6 /48) 在本次扫描中的应答情况
+type prefixState struct {
+	ok      int
+	recent  int // 上次降速以来的应答数
+	streak  int
+	pps     float64
+	limiter *rateLimiter
+	retry   []job // 超时的目标，在判定为疑似限速后于扫描末尾以降低后的速率重试
+}
+
+// throttle 按网段检测远端或中间设备的ICMP限速：一个网段在出现过应答之后连续超时，
+// 与主机不存在相比更像是被限速，此后降低向该网段发送的速率，并在扫描末尾重试超时的目标
+type throttle struct {
+	mu       sync.Mutex
+	prefixes map[netip.Prefix]*prefixState
+}
+
+func newThrottle() *throttle {
+	return &throttle{prefixes: make(map[netip.Prefix]*prefixState)}
+}
+
+// throttlePrefix 返回地址所属的网段，地址无法解析时返回零值
+func throttlePrefix(ip string) netip.Prefix {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return netip.Prefix{}
+	}
+	bits := 24
+	if addr.Is6() && !addr.Is4In6() {
+		bits = 48
+	}
+	prefix, _ := addr.Prefix(bits)
+	return prefix
+}
+
+func (th *throttle) state(ip string) *prefixState {
+	prefix := throttlePrefix(ip)
+	st, ok := th.prefixes[prefix]
+	if !ok {
+		st = &prefixState{}
+		th.prefixes[prefix] = st
+	}
+	return st
+}
+
+// wait 在目标所属网段已降速时等待该网段的限速器
+func (th *throttle) wait(ip string) {
+	th.mu.Lock()
+	limiter := th.state(ip).limiter
+	th.mu.Unlock()
+	if limiter != nil {
+		limiter.wait()
+	}
+}
+
+// observe 记录一次探测的结果，在网段连续超时时降低其发送速率
+func (th *throttle) observe(j job, err error) {
+	if err != nil && !errors.Is(err, errTimeout) {
+		return
+	}
+
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	st := th.state(j.t.ip)
+	if err == nil {
+		st.ok++
+		st.recent++
+		st.streak = 0
+		return
+	}
+
+	st.retry = append(st.retry, j)
+	st.streak++
+	if st.ok == 0 || st.streak < throttleStreak {
+		return
+	}
+	st.streak = 0
+	switch {
+	case st.pps == 0:
+		st.pps = throttlePPS
+	case st.recent > 0 && st.pps > 1:
+		// 降速后仍有应答又再次连续超时，说明速率仍高于限速
+		st.pps /= 2
+	default:
+		// 降速后没有任何应答，剩余的目标更可能确实无响应，不再继续降速
+		return
+	}
+	st.recent = 0
+	st.limiter = newRateLimiter(st.pps)
+	slog.Warn("检测到疑似ICMP限速，降低发送速率", "prefix", throttlePrefix(j.t.ip), "pps", st.pps)
+}
+
+// limitedPrefixes 返回判定为疑似限速的网段及其待重试的目标
+func (th *throttle) limitedPrefixes() map[netip.Prefix]*prefixState {
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	limited := make(map[netip.Prefix]*prefixState)
+	for prefix, st := range th.prefixes {
+		if st.limiter != nil && len(st.retry) > 0 {
+			limited[prefix] = st
+		}
+	}
+	return limited
+}
+
+// retryThrottled 以各网段降低后的速率逐个重试疑似限速网段中超时的目标，返回重试成功的结果。
+// 网段中有目标在降速后恢复应答即确认限速，其余仍然超时的目标记为限速而非无响应
+func (s *scanner) retryThrottled() []result {
+	limited := s.throttle.limitedPrefixes()
+	if len(limited) == 0 {
+		return nil
+	}
+	slog.Info("正在以降低的速率重试疑似限速网段", "prefixes", len(limited))
+
+	var (
+		mu      sync.Mutex
+		results []result
+		wg      sync.WaitGroup
+	)
+	sem := make(chan struct{}, max(*maxThreads, 1))
+	for prefix, st := range limited {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+
+			var ok []result
+			var failed []string
+			for _, j := range st.retry {
+				st.limiter.wait()
+				res, err := s.probeTarget(j.t, s.pool.pick(j.index, j.t.ip))
+				if err != nil {
+					failed = append(failed, j.t.ip)
+					continue
+				}
+				ok = append(ok, res)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			results = append(results, ok...)
+			if len(ok) == 0 {
+				return
+			}
+			slog.Warn("确认网段存在ICMP限速", "prefix", prefix, "pps", st.pps, "recovered", len(ok), "limited", len(failed))
+			s.limited = append(s.limited, failed...)
+		}()
+	}
+	wg.Wait()
+	return results
+}
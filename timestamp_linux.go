@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// enableKernelTimestamps 开启 SO_TIMESTAMPNS，让内核在每个收到的报文上附带纳秒精度的接收时间
+func enableKernelTimestamps(conn net.PacketConn) bool {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return false
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return false
+	}
+	var serr error
+	if err := raw.Control(func(fd uintptr) {
+		serr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_TIMESTAMPNS, 1)
+	}); err != nil {
+		return false
+	}
+	return serr == nil
+}
+
+// kernelTimestamp 从控制消息中取出 SCM_TIMESTAMPNS 接收时间
+func kernelTimestamp(oob []byte) (time.Time, bool) {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return time.Time{}, false
+	}
+	for _, m := range msgs {
+		if m.Header.Level == unix.SOL_SOCKET && m.Header.Type == unix.SCM_TIMESTAMPNS && len(m.Data) >= int(unsafe.Sizeof(unix.Timespec{})) {
+			ts := (*unix.Timespec)(unsafe.Pointer(&m.Data[0]))
+			return time.Unix(ts.Unix()), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// maxReceiveDelay 为内核收到报文到读取返回之间可信的最长间隔，超过时认为期间系统时钟被调整过
+const maxReceiveDelay = time.Second
+
+// monotonicReceive 把内核时间戳换算为带单调时钟读数的接收时间。内核时间戳取自可被NTP或手动调整的系统时钟，
+// 直接与发送时记录的单调时间相减会受时钟跳变影响，因此只取内核接收到读取返回之间的间隔，从读取返回的时间中减去
+func monotonicReceive(now, kernel time.Time) time.Time {
+	delay := now.Round(0).Sub(kernel)
+	if delay < 0 || delay > maxReceiveDelay {
+		return now
+	}
+	return now.Add(-delay)
+}
+
+// readTimestamped 读取一个报文及其接收时间，内核时间戳不可用时使用读取返回时的时间。
+// 返回的时间总是带有单调时钟读数，与发送时的 time.Now() 相减不受系统时钟调整的影响
+func readTimestamped(conn net.PacketConn, b []byte, kernel bool) (int, net.Addr, time.Time, error) {
+	if kernel {
+		oob := make([]byte, unix.CmsgSpace(int(unsafe.Sizeof(unix.Timespec{}))))
+		var n, oobn int
+		var peer net.Addr
+		var err error
+		switch c := conn.(type) {
+		case *net.IPConn:
+			var addr *net.IPAddr
+			n, oobn, _, addr, err = c.ReadMsgIP(b, oob)
+			peer = addr
+			// 与 ReadFrom 不同，ReadMsgIP 不会去掉IPv4原始套接字收到的IP头部
+			if err == nil && n >= 20 && b[0]>>4 == 4 && c.LocalAddr().(*net.IPAddr).IP.To4() != nil {
+				ihl := int(b[0]&0x0f) * 4
+				if ihl >= 20 && ihl <= n {
+					n = copy(b, b[ihl:n])
+				}
+			}
+		case *net.UDPConn:
+			var addr *net.UDPAddr
+			n, oobn, _, addr, err = c.ReadMsgUDP(b, oob)
+			peer = addr
+		default:
+			n, peer, err = conn.ReadFrom(b)
+		}
+		now := time.Now()
+		if err != nil {
+			return 0, nil, now, err
+		}
+		if ts, ok := kernelTimestamp(oob[:oobn]); ok {
+			return n, peer, monotonicReceive(now, ts), nil
+		}
+		return n, peer, now, nil
+	}
+
+	n, peer, err := conn.ReadFrom(b)
+	return n, peer, time.Now(), err
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package main
+
+import (
+	"net"
+	"time"
+)
+
+func enableKernelTimestamps(conn net.PacketConn) bool {
+	return false
+}
+
+func readTimestamped(conn net.PacketConn, b []byte, kernel bool) (int, net.Addr, time.Time, error) {
+	n, peer, err := conn.ReadFrom(b)
+	return n, peer, time.Now(), err
+}
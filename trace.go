@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tracer 为 -debug-probes 选中的目标，未设置时为 nil
+var tracer *traceFilter
+
+// traceFilter 按地址或抽样比例选择需要逐个记录收发过程的目标。
+// 抽样按地址的哈希判断，同一目标的每次探测要么都被记录，要么都不记录
+type traceFilter struct {
+	targets map[string]bool
+	rate    float64
+}
+
+// parseTraceFilter 解析 -debug-probes，值为逗号分隔的目标地址或主机名，或以百分号结尾的抽样比例，如 1.2.3.4 或 5%
+func parseTraceFilter(s string) (*traceFilter, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if pct, ok := strings.CutSuffix(s, "%"); ok {
+		rate, err := strconv.ParseFloat(pct, 64)
+		if err != nil || rate <= 0 || rate > 100 {
+			return nil, fmt.Errorf("无效的 -debug-probes 抽样比例: %s", s)
+		}
+		return &traceFilter{rate: rate / 100}, nil
+	}
+	f := &traceFilter{targets: make(map[string]bool)}
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			f.targets[traceKey(t)] = true
+		}
+	}
+	if len(f.targets) == 0 {
+		return nil, fmt.Errorf("-debug-probes 没有指定目标")
+	}
+	return f, nil
+}
+
+// traceKey 把地址规范化以便比较，主机名原样返回
+func traceKey(ip string) string {
+	if addr, err := netip.ParseAddr(ip); err == nil {
+		return addr.String()
+	}
+	return ip
+}
+
+// traced 判断 ips 中是否有被 -debug-probes 选中的目标，同一目标可能以主机名和解析出的地址两种形式出现
+func traced(ips ...string) bool {
+	if tracer == nil {
+		return false
+	}
+	for _, ip := range ips {
+		key := traceKey(ip)
+		if tracer.targets != nil {
+			if tracer.targets[key] {
+				return true
+			}
+			continue
+		}
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		if float64(h.Sum32())/(1<<32) < tracer.rate {
+			return true
+		}
+	}
+	return false
+}
+
+// traceProbe 记录选中目标的一次收发事件，at 为报文的发送或接收时间，按微秒精度输出以便对照抓包
+func traceProbe(event, ip string, at time.Time, args ...any) {
+	attrs := append([]any{"ip", ip, "at", at.Format("15:04:05.000000")}, args...)
+	slog.Info("探测跟踪: "+event, attrs...)
+}
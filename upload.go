@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+)
+
+// s3Uploader 将写好的输出文件上传到S3兼容存储的 bucket/prefix 下
+type s3Uploader struct {
+	client *minio.Client
+	bucket string
+	prefix string
+	sse    encrypt.ServerSide
+}
+
+// newS3Uploader 解析 s3://bucket/prefix/ 形式的 -upload 地址，未设置时返回 nil。
+// 凭据依次从AWS和MinIO的环境变量、~/.aws/credentials 和实例元数据中获取
+func newS3Uploader(rawURL string) (*s3Uploader, error) {
+	if rawURL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("无效的上传地址，应为 s3://bucket/prefix/: %s", rawURL)
+	}
+
+	var sse encrypt.ServerSide
+	switch {
+	case *uploadSSE == "":
+	case *uploadSSE == "s3":
+		sse = encrypt.NewSSE()
+	case strings.HasPrefix(*uploadSSE, "kms:"):
+		sse, err = encrypt.NewSSEKMS(strings.TrimPrefix(*uploadSSE, "kms:"), nil)
+		if err != nil {
+			return nil, fmt.Errorf("无效的KMS加密配置: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("未知的服务端加密方式: %s", *uploadSSE)
+	}
+
+	client, err := minio.New(*uploadEndpoint, &minio.Options{
+		Creds:  awsCredentials(),
+		Secure: !*uploadInsecure,
+		Region: *uploadRegion,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("无法创建S3客户端: %v", err)
+	}
+
+	return &s3Uploader{
+		client: client,
+		bucket: u.Host,
+		prefix: strings.TrimPrefix(u.Path, "/"),
+		sse:    sse,
+	}, nil
+}
+
+// awsCredentials 依次从AWS和MinIO的环境变量、~/.aws/credentials 和实例元数据中获取凭据
+func awsCredentials() *credentials.Credentials {
+	return credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.EnvMinio{},
+		&credentials.FileAWSCredentials{},
+		&credentials.IAM{Client: &http.Client{Timeout: 5 * time.Second}},
+	})
+}
+
+// upload 依次上传文件，对象名为前缀加文件名
+func (s *s3Uploader) upload(files []string) error {
+	for _, file := range files {
+		key := path.Join(s.prefix, filepath.Base(file))
+		info, err := s.client.FPutObject(context.Background(), s.bucket, key, file, minio.PutObjectOptions{
+			ServerSideEncryption: s.sse,
+		})
+		if err != nil {
+			return fmt.Errorf("上传 %s 失败: %v", file, err)
+		}
+		slog.Info("成功上传文件", "file", file, "bucket", s.bucket, "key", key, "size", info.Size)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// rejectedLine 为输入文件中被丢弃的一行或一个目标
+type rejectedLine struct {
+	file   string
+	line   int
+	text   string
+	reason string
+}
+
+// validationReport 汇总读取目标文件时发现的问题，代替逐行打印错误
+type validationReport struct {
+	file       string // 正在读取的文件
+	lines      int
+	targets    int
+	duplicates int
+	excluded   int // 被 !CIDR 排除行移除的目标数
+	rejected   []rejectedLine
+}
+
+func (r *validationReport) reject(line int, text, reason string) {
+	r.rejected = append(r.rejected, rejectedLine{r.file, line, text, reason})
+}
+
+// print 记录校验摘要，存在问题时按原因分类计数
+func (r *validationReport) print() {
+	invalid := len(r.rejected) - r.duplicates
+	slog.Info("输入校验", "lines", r.lines, "targets", r.targets, "duplicates", r.duplicates, "invalid", invalid, "excluded", r.excluded)
+	if len(r.rejected) == 0 {
+		return
+	}
+
+	reasons := make(map[string]int)
+	var order []string
+	for _, rej := range r.rejected {
+		if reasons[rej.reason] == 0 {
+			order = append(order, rej.reason)
+		}
+		reasons[rej.reason]++
+	}
+	for _, reason := range order {
+		slog.Warn("丢弃无效输入", "reason", reason, "count", reasons[reason])
+	}
+	if *rejectsFile == "" {
+		slog.Info("使用 -rejects 文件名 查看被丢弃的具体内容")
+	}
+}
+
+// writeRejects 将被丢弃的行写入CSV文件
+func (r *validationReport) writeRejects(filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("无法创建文件: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"文件", "行号", "内容", "原因"})
+	for _, rej := range r.rejected {
+		writer.Write([]string{rej.file, strconv.Itoa(rej.line), rej.text, rej.reason})
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("写入CSV文件时出现错误: %v", err)
+	}
+	return nil
+}
+
+// validTarget 判断展开后的目标是否为IP地址或合法的主机名。IPv6链路本地地址可以带区域，如 fe80::1%eth0
+func validTarget(s string) bool {
+	if net.ParseIP(s) != nil {
+		return true
+	}
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return addr.Zone() != "" && (addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast())
+	}
+	if len(s) == 0 || len(s) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(s, "."), ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isAddress 判断目标是否为IP地址，包括带区域的IPv6地址
+func isAddress(s string) bool {
+	_, err := netip.ParseAddr(s)
+	return err == nil
+}
+
+// urlHost 返回用于URL的 主机:端口，链路本地地址的区域按 RFC 6874 转义为 %25
+func urlHost(ip, port string) string {
+	return net.JoinHostPort(strings.Replace(ip, "%", "%25", 1), port)
+}
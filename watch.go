@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+)
+
+// watchInterval 为 -watch 检查输入文件是否改变的间隔
+const watchInterval = time.Second
+
+// validateWatch 检查 -watch 只用于从 -file 读取的目标
+func validateWatch() error {
+	if *watchInput && (*randomCount > 0 || *sweep) {
+		return fmt.Errorf("-watch 只支持 -file 输入，不能与 -random 或 -sweep 同时使用")
+	}
+	// 缓存的结果在扫描开始时一次取出，追加的目标无法复用
+	if *watchInput && *cacheFile != "" {
+		return fmt.Errorf("-watch 不能与 -cache 同时使用")
+	}
+	return nil
+}
+
+// watchFiles 在扫描过程中按 watchInterval 检查各个 -file 的修改时间，文件改变后重新读取全部输入，
+// 把新增的目标追加到正在进行的扫描中。从文件中删除的目标已在探测中，不受影响。返回的函数停止检查。
+// 重新读取时不再输出校验报告或改写 -rejects 文件，只解析新增的主机名，新增的目标同样经过 -min-priority 和 -precheck
+func (s *scanner) watchFiles(labelColumns []string) func() {
+	read := func() ([]target, []string, error) {
+		var report validationReport
+		return readTargetFiles(inputFiles.names(), &report)
+	}
+	// known 为已经处理过的输入写法 (地址或主机名)
+	known := make(map[string]bool)
+	if initial, _, err := read(); err == nil {
+		for _, t := range initial {
+			known[t.ip] = true
+		}
+	}
+
+	mtimes := func() []time.Time {
+		var times []time.Time
+		for _, name := range inputFiles.names() {
+			info, err := os.Stat(name)
+			if err != nil {
+				times = append(times, time.Time{})
+				continue
+			}
+			times = append(times, info.ModTime())
+		}
+		return times
+	}
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		last := mtimes()
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			now := mtimes()
+			if slices.Equal(now, last) {
+				continue
+			}
+			last = now
+
+			targets, columns, err := read()
+			if err != nil {
+				slog.Warn("重新读取输入文件失败", "err", err)
+				continue
+			}
+			targets = slices.DeleteFunc(targets, func(t target) bool { return known[t.ip] })
+			specs := make([]string, len(targets))
+			for i, t := range targets {
+				specs[i] = t.ip
+			}
+			targets, columns = resolveTargets(targets, columns)
+			targets, columns = addOriginColumn(targets, columns)
+			if !slices.Equal(columns, labelColumns) {
+				slog.Warn("输入文件的标签列已改变，忽略本次修改", "columns", columns)
+				continue
+			}
+			if len(specs) == 0 {
+				continue
+			}
+			if *minPriority > 0 {
+				targets = slices.DeleteFunc(targets, func(t target) bool { return t.opts.priority < *minPriority })
+			}
+			slices.SortStableFunc(targets, func(a, b target) int { return b.opts.priority - a.opts.priority })
+			targets = s.precheck(targets)
+			n, dropped, err := s.feed.add(targets)
+			if err != nil {
+				slog.Warn("无法追加目标", "err", err)
+				continue
+			}
+			for _, spec := range specs {
+				known[spec] = true
+			}
+			if dropped > 0 {
+				slog.Warn("目标数量超过 -max-targets，已截断", "max", *maxTargets, "dropped", dropped)
+			}
+			if n > 0 {
+				slog.Info("输入文件已改变，已追加新增的目标", "added", n, "total", s.total.Load())
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-stopped
+	}
+}